@@ -16,10 +16,37 @@ limitations under the License.
 package v1
 
 import (
+	"strings"
+
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// DefaultMinReplicas is the minimum number of gateways run when MinReplicas is not set
+	DefaultMinReplicas int32 = 3
+	// DefaultMaxReplicas is the maximum number of gateways run when MaxReplicas is not set
+	DefaultMaxReplicas int32 = 12
+	// DefaultTargetCPUUtilizationPercentage is the autoscaling target used when TargetCPUUtilizationPercentage is not set
+	DefaultTargetCPUUtilizationPercentage int32 = 50
 )
 
+// DefaultResources returns the compute resources given to gateway pods when Resources is not set
+func DefaultResources() v1.ResourceRequirements {
+	return v1.ResourceRequirements{
+		Requests: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("100m"),
+			v1.ResourceMemory: resource.MustParse("50Mi"),
+		},
+		Limits: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("2"),
+			v1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+	}
+}
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
@@ -28,44 +55,114 @@ type ExternalServiceSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// DnsName is a DNS name target for the external service
+	// DnsName is a DNS name target for the external service. It may be a wildcard such as
+	// *.s3.eu-west-1.amazonaws.com, in which case any subdomain is routed to the gateway and forwarded to the
+	// hostname requested in the TLS SNI of each connection. Wildcards only support TCP ports carrying TLS.
 	DnsName string `json:"dnsName,omitempty"`
 
+	// AdditionalDnsNames are aliases for DnsName, such as regional or legacy hostnames of the same backend.
+	// They are hijacked to the same gateway, which connects upstream using DnsName, unless DnsName is a wildcard:
+	// then they are also accepted as SNI server names, and the gateway connects to the host each connection requested.
+	// +optional
+	AdditionalDnsNames []string `json:"additionalDnsNames,omitempty"`
+
 	// Ports is a list of ports on which the external service may be called
 	Ports []ExternalServicePort `json:"ports,omitempty"`
 
 	// MinReplicas is the minimum number of gateways to run. Defaults to 3
 	// +optional
+	// +kubebuilder:default=3
 	MinReplicas *int32 `json:"minReplicas,omitempty"`
 
 	// MaxReplicas is the maximum number of gateways to run, enforced by HorizontalPodAutoscaler. Defaults to 12
 	// +optional
+	// +kubebuilder:default=12
 	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
 
 	// Target average CPU utilization (represented as a percentage of requested CPU) over all the pods. Defaults to 50
 	// +optional
+	// +kubebuilder:default=50
 	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
 
 	// ResourceRequirements describes the compute resource requirements for gateway pods. Defaults to 100m, 50Mi, 2, 1Gi
 	// +optional
+	// +kubebuilder:default={requests:{cpu:"100m",memory:"50Mi"},limits:{cpu:"2",memory:"1Gi"}}
 	Resources *v1.ResourceRequirements `json:"resources,omitempty"`
 
+	// ClientCertificate is presented to the external service for mutual TLS by every port with tls set,
+	// unless the port names its own clientCertificateSecretName
+	// +optional
+	ClientCertificate *ClientCertificate `json:"clientCertificate,omitempty"`
+
+	// DiscoveryType is LOGICAL_DNS (the default), which connects to the first address DnsName resolves to,
+	// or STRICT_DNS, which balances connections across every address DnsName resolves to
+	// +optional
+	// +kubebuilder:validation:Enum=LOGICAL_DNS;STRICT_DNS
+	DiscoveryType DiscoveryType `json:"discoveryType,omitempty"`
+
+	// LbPolicy picks the upstream host for each connection or request: ROUND_ROBIN (the default),
+	// LEAST_REQUEST, RANDOM or RING_HASH, which keeps each client on the same host by hashing its source IP
+	// +optional
+	// +kubebuilder:validation:Enum=ROUND_ROBIN;LEAST_REQUEST;RANDOM;RING_HASH
+	LbPolicy LbPolicy `json:"lbPolicy,omitempty"`
+
+	// Connection tunes timeouts, connect attempts and TCP keepalive for every port. Ports can override
+	// individual settings with their own connection
+	// +optional
+	Connection *ConnectionSettings `json:"connection,omitempty"`
+
+	// HealthCheck actively checks the external service's hosts from every gateway. Hosts overridden by
+	// IpOverride are always TCP health checked, with these settings if provided
+	// +optional
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+
+	// OutlierDetection ejects hosts which fail to accept connections or return errors
+	// +optional
+	OutlierDetection *OutlierDetection `json:"outlierDetection,omitempty"`
+
 	// If true, add a `egress.monzo.com/hijack-dns: true` label to produced Service objects
 	// CoreDNS can watch this label and decide to rewrite DnsName -> clusterIP
 	HijackDns bool `json:"hijackDns,omitempty"`
 
-	// When set allows overwriting the A records of the DNS being overridden.
+	// When set allows overwriting the A (or, for IPv6 families, AAAA) records of the DNS being overridden.
 	// +optional
 	IpOverride []string `json:"ipOverride,omitempty"`
 
+	// IpFamily is the IP family gateways listen on, resolve DnsName with and give their Service: IPv4,
+	// IPv6, or DualStackPreferIPv4/DualStackPreferIPv6 to use both. Defaults to IPv4, leaving the Service's
+	// families to the cluster
+	// +optional
+	// +kubebuilder:validation:Enum=IPv4;IPv6;DualStackPreferIPv4;DualStackPreferIPv6
+	IpFamily IpFamily `json:"ipFamily,omitempty"`
+
 	// The maximum number of connections that Envoy will establish to all hosts in an upstream cluster (defaults to 1024).
 	// If this circuit breaker overflows the upstream_cx_overflow counter for the cluster will increment.
 	// +optional
 	EnvoyClusterMaxConnections *uint32 `json:"envoyClusterMaxConnections,omitempty"`
 
+	// CircuitBreakers limits the connections, requests and retries each gateway sends to the external service.
+	// Its maxConnections replaces EnvoyClusterMaxConnections
+	// +optional
+	CircuitBreakers *CircuitBreakers `json:"circuitBreakers,omitempty"`
+
 	// Input to the --log-level command line option. See the help text for the available log levels and the default.
 	EnvoyLogLevel string `json:"envoyLogLevel,omitempty"`
 
+	// EnvoyImage runs this gateway on a different image than the operator's default, such as to canary a new
+	// Envoy version on a few destinations. It must be in the operator's ENVOY_IMAGE_ALLOWLIST
+	// +optional
+	EnvoyImage string `json:"envoyImage,omitempty"`
+
+	// PodTemplate is a partial pod template strategic-merged over the gateway's generated one, after the operator's
+	// default overlay. Containers, volumes and env vars are merged by name, so it can add a sidecar or env vars to the
+	// gateway container, and set fields like priorityClassName, imagePullSecrets, serviceAccountName or affinity.
+	// Labels and annotations set by the operator, and the gateway container's image, command and args, can't be changed,
+	// and pods can't be given the node's namespaces, hostPath volumes, hostPorts, added capabilities or privileges
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	PodTemplate *runtime.RawExtension `json:"podTemplate,omitempty"`
+
 	// Corresponds to Envoy's dns_refresh_rate config field for this cluster, in seconds
 	// See	https://www.envoyproxy.io/docs/envoy/latest/api-v3/config/cluster/v3/cluster.proto
 	// +optional
@@ -89,26 +186,549 @@ type ExternalServiceSpec struct {
 	// Defaults to false
 	// +optional
 	JsonClusterAccessLogs bool `json:"envoyJsonClusterAccessLogs,omitempty"`
+
+	// AccessLog customises the gateway's access logs and sends them to further sinks. Settings left unset use the
+	// operator's default access log configuration
+	// +optional
+	AccessLog *AccessLog `json:"accessLog,omitempty"`
+}
+
+// ConnectionFor returns the connection settings for port, where each setting the port sets overrides the spec-wide one
+func (s *ExternalServiceSpec) ConnectionFor(port ExternalServicePort) ConnectionSettings {
+	var c ConnectionSettings
+	for _, settings := range []*ConnectionSettings{s.Connection, port.Connection} {
+		if settings == nil {
+			continue
+		}
+		if settings.ConnectTimeoutSeconds != 0 {
+			c.ConnectTimeoutSeconds = settings.ConnectTimeoutSeconds
+		}
+		if settings.IdleTimeoutSeconds != 0 {
+			c.IdleTimeoutSeconds = settings.IdleTimeoutSeconds
+		}
+		if settings.MaxConnectAttempts != 0 {
+			c.MaxConnectAttempts = settings.MaxConnectAttempts
+		}
+		if settings.MaxClientConnections != 0 {
+			c.MaxClientConnections = settings.MaxClientConnections
+		}
+		if settings.TcpKeepalive != nil {
+			k := TcpKeepalive{}
+			if c.TcpKeepalive != nil {
+				k = *c.TcpKeepalive
+			}
+			if settings.TcpKeepalive.Probes != 0 {
+				k.Probes = settings.TcpKeepalive.Probes
+			}
+			if settings.TcpKeepalive.TimeSeconds != 0 {
+				k.TimeSeconds = settings.TcpKeepalive.TimeSeconds
+			}
+			if settings.TcpKeepalive.IntervalSeconds != 0 {
+				k.IntervalSeconds = settings.TcpKeepalive.IntervalSeconds
+			}
+			c.TcpKeepalive = &k
+		}
+	}
+	return c
+}
+
+// IsWildcard returns true if DnsName is a wildcard matching any subdomain
+func (s *ExternalServiceSpec) IsWildcard() bool {
+	return strings.HasPrefix(s.DnsName, "*.")
+}
+
+// DnsNames returns DnsName followed by any AdditionalDnsNames
+func (s *ExternalServiceSpec) DnsNames() []string {
+	return append([]string{s.DnsName}, s.AdditionalDnsNames...)
 }
 
 type ExternalServicePort struct {
 	// The protocol (TCP or UDP) which traffic must match. If not specified, this
 	// field defaults to TCP.
 	// +optional
+	// +kubebuilder:default=TCP
 	Protocol *v1.Protocol `json:"protocol,omitempty"`
 
 	// The port on the given protocol.
 	Port int32 `json:"port,omitempty"`
+
+	// AllowedServerNames restricts a TCP port to TLS connections whose ClientHello SNI is one of these names.
+	// Entries may be wildcards such as *.example.com. Connections without a matching SNI are closed.
+	// +optional
+	AllowedServerNames []string `json:"allowedServerNames,omitempty"`
+
+	// Mode is tcp (the default) to proxy a TCP port byte for byte, or http to proxy plaintext HTTP requests.
+	// In http mode only requests for DnsName or AdditionalDnsNames are forwarded and every request is logged.
+	// +optional
+	// +kubebuilder:validation:Enum=tcp;http
+	Mode PortMode `json:"mode,omitempty"`
+
+	// HTTP restricts the requests forwarded by a port in http mode
+	// +optional
+	HTTP *HTTPPortOptions `json:"http,omitempty"`
+
+	// TLS, if set, makes the gateway accept plaintext from clients on Port and originate TLS to the external
+	// service, using DnsName as the SNI and to verify the external service's certificate
+	// +optional
+	TLS *TLSOrigination `json:"tls,omitempty"`
+
+	// Connection overrides the spec-wide connection settings for this port
+	// +optional
+	Connection *ConnectionSettings `json:"connection,omitempty"`
+
+	// RateLimit limits how fast each gateway pod accepts connections or, in http mode, requests on a TCP port
+	// +optional
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+}
+
+// RateLimit is a pair of token buckets, one taken from by each new connection and one by each request
+type RateLimit struct {
+	// Connections limits new connections. Connections over the limit are closed immediately
+	// +optional
+	Connections *TokenBucket `json:"connections,omitempty"`
+
+	// Requests limits requests on a port in http mode. Requests over the limit get a 429 response
+	// +optional
+	Requests *TokenBucket `json:"requests,omitempty"`
+}
+
+// TokenBucket allows bursts of up to MaxTokens, refilling TokensPerFill tokens every FillIntervalSeconds
+type TokenBucket struct {
+	// +kubebuilder:validation:Minimum=1
+	MaxTokens int32 `json:"maxTokens"`
+
+	// Defaults to 1
+	// +optional
+	TokensPerFill int32 `json:"tokensPerFill,omitempty"`
+
+	// Defaults to 1
+	// +optional
+	FillIntervalSeconds int32 `json:"fillIntervalSeconds,omitempty"`
+}
+
+// UpstreamPort returns the port on the external service that the gateway connects to
+func (p ExternalServicePort) UpstreamPort() int32 {
+	if p.TLS != nil && p.TLS.TargetPort != 0 {
+		return p.TLS.TargetPort
+	}
+	return p.Port
+}
+
+type TLSOrigination struct {
+	// TargetPort is the port on the external service to connect to with TLS. Defaults to Port
+	// +optional
+	TargetPort int32 `json:"targetPort,omitempty"`
+
+	// CASecretName is a Secret in the egress-operator-system namespace whose ca.crt key holds the CA bundle
+	// used to verify the external service. Defaults to the gateway image's system CA bundle
+	// +optional
+	CASecretName string `json:"caSecretName,omitempty"`
+
+	// ClientCertificateSecretName is a kubernetes.io/tls Secret in the egress-operator-system namespace whose
+	// certificate is presented to the external service for mutual TLS
+	// +optional
+	ClientCertificateSecretName string `json:"clientCertificateSecretName,omitempty"`
+}
+
+type ClientCertificate struct {
+	// SecretName is a kubernetes.io/tls Secret in the egress-operator-system namespace holding the client
+	// certificate and key. Defaults to <name>-client-certificate when Issuer is set
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// Issuer, if set, makes the operator request the client certificate from cert-manager, which must be
+	// installed in the cluster
+	// +optional
+	Issuer *CertificateIssuer `json:"issuer,omitempty"`
+}
+
+type CertificateIssuer struct {
+	// Name of the cert-manager Issuer (in the egress-operator-system namespace) or ClusterIssuer
+	Name string `json:"name"`
+
+	// Kind is Issuer or ClusterIssuer. Defaults to Issuer
+	// +optional
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	Kind string `json:"kind,omitempty"`
+
+	// CommonName of the client certificate. Defaults to the ExternalService's name
+	// +optional
+	CommonName string `json:"commonName,omitempty"`
+}
+
+// ClientCertificateSecretName returns the Secret holding the ExternalService's client certificate, or
+// an empty string if it doesn't have one
+func (es *ExternalService) ClientCertificateSecretName() string {
+	c := es.Spec.ClientCertificate
+	switch {
+	case c == nil:
+		return ""
+	case c.SecretName != "":
+		return c.SecretName
+	case c.Issuer != nil:
+		return es.Name + "-client-certificate"
+	default:
+		return ""
+	}
+}
+
+// AccessLog configures the access logs written for each client connection, or request on http mode ports
+type AccessLog struct {
+	// TextFormat replaces the default text format of access logs, using Envoy's command operators
+	// such as %DOWNSTREAM_REMOTE_ADDRESS%
+	// +optional
+	TextFormat string `json:"textFormat,omitempty"`
+
+	// JsonFormat replaces the default fields of JSON access logs, mapping each field to a command operator
+	// +optional
+	JsonFormat map[string]string `json:"jsonFormat,omitempty"`
+
+	// Sinks are where access logs are sent in addition to stdout
+	// +optional
+	Sinks []AccessLogSink `json:"sinks,omitempty"`
+
+	// Filter limits which connections or requests are logged, to stdout and every sink
+	// +optional
+	Filter *AccessLogFilter `json:"filter,omitempty"`
+
+	// DisableAdminLogs stops logging requests to the admin interface, such as readiness probes
+	// +optional
+	DisableAdminLogs *bool `json:"disableAdminLogs,omitempty"`
 }
 
+// AccessLogFilter limits which connections or requests are logged. When several are set, only entries matching all
+// of them are logged.
+type AccessLogFilter struct {
+	// SamplePercent is the percentage of entries to log. Defaults to 100
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	SamplePercent *int32 `json:"samplePercent,omitempty"`
+
+	// OnlyErrors only logs entries with response flags, which Envoy sets when a connection or request fails, such as
+	// UF for an upstream connection failure
+	// +optional
+	OnlyErrors bool `json:"onlyErrors,omitempty"`
+
+	// MinDurationMilliseconds only logs entries which lasted at least this long
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinDurationMilliseconds int32 `json:"minDurationMilliseconds,omitempty"`
+}
+
+// AccessLogSinkType is where an access log sink sends logs
+type AccessLogSinkType string
+
+const (
+	AccessLogSinkFile          AccessLogSinkType = "File"
+	AccessLogSinkGRPC          AccessLogSinkType = "GRPC"
+	AccessLogSinkOpenTelemetry AccessLogSinkType = "OpenTelemetry"
+)
+
+type AccessLogSink struct {
+	// Type is File to write to a file in the gateway container, GRPC to send logs to an Envoy gRPC access log
+	// service, or OpenTelemetry to send logs to an OpenTelemetry collector over OTLP/gRPC
+	// +kubebuilder:validation:Enum=File;GRPC;OpenTelemetry
+	Type AccessLogSinkType `json:"type"`
+
+	// Path is the file File sinks write to
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// Address is the host:port GRPC and OpenTelemetry sinks send to. Gateway pods use the node's DNS resolver, so it
+	// should be an IP, such as a collector Service's ClusterIP, or a name the node can resolve
+	// +optional
+	Address string `json:"address,omitempty"`
+
+	// LogName identifies the gateway's logs to GRPC and OpenTelemetry sinks. Defaults to the ExternalService's name
+	// +optional
+	LogName string `json:"logName,omitempty"`
+}
+
+// ConnectionSettings tunes connections through a gateway. Unset fields keep their defaults
+type ConnectionSettings struct {
+	// ConnectTimeoutSeconds is how long to wait for a connection to the external service. Defaults to 1
+	// +optional
+	ConnectTimeoutSeconds int32 `json:"connectTimeoutSeconds,omitempty"`
+
+	// IdleTimeoutSeconds closes client connections (or, on UDP ports, sessions) with no traffic for this long.
+	// Defaults to one hour, or one minute on UDP ports
+	// +optional
+	IdleTimeoutSeconds int32 `json:"idleTimeoutSeconds,omitempty"`
+
+	// MaxConnectAttempts is how many times to try connecting to the external service before closing the
+	// client's connection. Only used by TCP mode ports. Defaults to 1
+	// +optional
+	MaxConnectAttempts int32 `json:"maxConnectAttempts,omitempty"`
+
+	// TcpKeepalive configures keepalive probes on connections to the external service
+	// +optional
+	TcpKeepalive *TcpKeepalive `json:"tcpKeepalive,omitempty"`
+
+	// MaxClientConnections limits the connections each gateway pod accepts on a TCP port. Further connections
+	// are closed immediately. Unlimited by default
+	// +optional
+	MaxClientConnections int32 `json:"maxClientConnections,omitempty"`
+}
+
+// TcpKeepalive configures TCP keepalive probes. Unset fields keep their defaults
+type TcpKeepalive struct {
+	// Probes is how many unanswered probes close the connection. Defaults to 3
+	// +optional
+	Probes int32 `json:"probes,omitempty"`
+
+	// TimeSeconds is how long a connection is idle before probes are sent. Defaults to 30
+	// +optional
+	TimeSeconds int32 `json:"timeSeconds,omitempty"`
+
+	// IntervalSeconds is the time between probes. Defaults to 5
+	// +optional
+	IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
+}
+
+// CircuitBreakers are Envoy's circuit breaker thresholds. Unset fields keep Envoy's defaults of 1024
+// connections, pending requests and requests, and 3 concurrent retries
+type CircuitBreakers struct {
+	// +optional
+	MaxConnections int32 `json:"maxConnections,omitempty"`
+
+	// MaxPendingRequests only applies to http mode ports
+	// +optional
+	MaxPendingRequests int32 `json:"maxPendingRequests,omitempty"`
+
+	// MaxRequests only applies to http mode ports
+	// +optional
+	MaxRequests int32 `json:"maxRequests,omitempty"`
+
+	// MaxRetries is how many retries may be outstanding at once, including connect attempts beyond the first
+	// +optional
+	MaxRetries int32 `json:"maxRetries,omitempty"`
+
+	// PerHostMaxConnections limits the connections to each upstream host
+	// +optional
+	PerHostMaxConnections int32 `json:"perHostMaxConnections,omitempty"`
+
+	// RetryBudget limits concurrent retries to a share of active requests, replacing MaxRetries
+	// +optional
+	RetryBudget *RetryBudget `json:"retryBudget,omitempty"`
+}
+
+// RetryBudget limits retries to a share of the requests active against the external service
+type RetryBudget struct {
+	// BudgetPercent is the percentage of active requests that may be retries. Defaults to 20
+	// +optional
+	BudgetPercent int32 `json:"budgetPercent,omitempty"`
+
+	// MinRetryConcurrency is how many retries are allowed regardless of the budget. Defaults to 3
+	// +optional
+	MinRetryConcurrency int32 `json:"minRetryConcurrency,omitempty"`
+}
+
+// DiscoveryType is how gateways turn DnsName into upstream hosts
+type DiscoveryType string
+
+const (
+	DiscoveryTypeLogicalDNS DiscoveryType = "LOGICAL_DNS"
+	DiscoveryTypeStrictDNS  DiscoveryType = "STRICT_DNS"
+)
+
+// LbPolicy is how gateways balance load across upstream hosts
+type LbPolicy string
+
+const (
+	LbPolicyRoundRobin   LbPolicy = "ROUND_ROBIN"
+	LbPolicyLeastRequest LbPolicy = "LEAST_REQUEST"
+	LbPolicyRandom       LbPolicy = "RANDOM"
+	LbPolicyRingHash     LbPolicy = "RING_HASH"
+)
+
+// IpFamily is which IP families a gateway serves
+type IpFamily string
+
+const (
+	IpFamilyIPv4                IpFamily = "IPv4"
+	IpFamilyIPv6                IpFamily = "IPv6"
+	IpFamilyDualStackPreferIPv4 IpFamily = "DualStackPreferIPv4"
+	IpFamilyDualStackPreferIPv6 IpFamily = "DualStackPreferIPv6"
+)
+
+// IsDualStack returns true if gateways serve both IPv4 and IPv6
+func (f IpFamily) IsDualStack() bool {
+	return f == IpFamilyDualStackPreferIPv4 || f == IpFamilyDualStackPreferIPv6
+}
+
+// HasIPv4 returns true if gateways serve IPv4, which they do unless IPv6 is chosen
+func (f IpFamily) HasIPv4() bool {
+	return f != IpFamilyIPv6
+}
+
+// HasIPv6 returns true if gateways serve IPv6
+func (f IpFamily) HasIPv6() bool {
+	return f == IpFamilyIPv6 || f.IsDualStack()
+}
+
+// HealthCheckType is the kind of health check performed against the external service
+type HealthCheckType string
+
+const (
+	// HealthCheckTCP checks that a connection can be established
+	HealthCheckTCP HealthCheckType = "TCP"
+	// HealthCheckHTTP requests Path and checks for an expected status code
+	HealthCheckHTTP HealthCheckType = "HTTP"
+	// HealthCheckTLS checks that a TLS handshake with DnsName as the SNI completes
+	HealthCheckTLS HealthCheckType = "TLS"
+)
+
+type HealthCheck struct {
+	// Type is TCP, HTTP or TLS. Defaults to TCP. HTTP health checks use TLS on ports with tls set, and every TCP
+	// port must either be in http mode or have tls set. TLS health checks need tls set on every http mode port
+	// +optional
+	// +kubebuilder:validation:Enum=TCP;HTTP;TLS
+	Type HealthCheckType `json:"type,omitempty"`
+
+	// Path requested by HTTP health checks. Defaults to /
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// ExpectedStatuses are the status codes HTTP health checks consider healthy. Defaults to 200
+	// +optional
+	ExpectedStatuses []int32 `json:"expectedStatuses,omitempty"`
+
+	// IntervalSeconds between health checks. Defaults to 10
+	// +optional
+	IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
+
+	// TimeoutSeconds to wait for each health check. Defaults to 1
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+
+	// UnhealthyThreshold is the number of failed health checks before a host is unhealthy. Defaults to 2
+	// +optional
+	UnhealthyThreshold int32 `json:"unhealthyThreshold,omitempty"`
+
+	// HealthyThreshold is the number of passed health checks before a host is healthy again. Defaults to 3
+	// +optional
+	HealthyThreshold int32 `json:"healthyThreshold,omitempty"`
+}
+
+type OutlierDetection struct {
+	// ConsecutiveFailures is the number of consecutive connection failures or 5xx responses after which a host
+	// is ejected. Defaults to 5
+	// +optional
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+
+	// IntervalSeconds between ejection sweeps. Defaults to 10
+	// +optional
+	IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
+
+	// BaseEjectionTimeSeconds is how long a host is ejected for, multiplied by the number of times it has been
+	// ejected. Defaults to 30
+	// +optional
+	BaseEjectionTimeSeconds int32 `json:"baseEjectionTimeSeconds,omitempty"`
+
+	// MaxEjectionPercent is the most hosts which may be ejected at once, although at least one host can always
+	// be ejected. Defaults to 10
+	// +optional
+	MaxEjectionPercent int32 `json:"maxEjectionPercent,omitempty"`
+}
+
+// PortMode determines how a gateway proxies a TCP port
+type PortMode string
+
+const (
+	PortModeTCP  PortMode = "tcp"
+	PortModeHTTP PortMode = "http"
+)
+
+// IsHTTP returns true if the port proxies HTTP requests rather than bytes
+func (p ExternalServicePort) IsHTTP() bool {
+	return p.Mode == PortModeHTTP
+}
+
+type HTTPPortOptions struct {
+	// AllowedMethods, if set, are the only HTTP methods forwarded, such as GET or POST
+	// +optional
+	AllowedMethods []string `json:"allowedMethods,omitempty"`
+
+	// AllowedPathPrefixes, if set, are the only path prefixes forwarded, such as /v1/
+	// +optional
+	AllowedPathPrefixes []string `json:"allowedPathPrefixes,omitempty"`
+}
+
+// ServerNames returns the SNI server names a TCP port accepts, or nil if any connection is accepted.
+// Wildcard ExternalServices always require an SNI matching one of their names.
+func (s *ExternalServiceSpec) ServerNames(port ExternalServicePort) []string {
+	if len(port.AllowedServerNames) > 0 {
+		return port.AllowedServerNames
+	}
+	if s.IsWildcard() {
+		return s.DnsNames()
+	}
+	return nil
+}
+
+// Condition types reported on ExternalServiceStatus.Conditions
+const (
+	// ConditionReady is true when at least one gateway pod is ready to serve traffic
+	ConditionReady = "Ready"
+	// ConditionConfigValid is true when an Envoy configuration could be generated from the spec and passed validation
+	ConditionConfigValid = "ConfigValid"
+	// ConditionDnsHijackActive is true when the CoreDNS plugin is rewriting DnsName to the gateway Service
+	ConditionDnsHijackActive = "DnsHijackActive"
+	// ConditionDegraded is true when fewer gateway pods are ready than desired
+	ConditionDegraded = "Degraded"
+	// ConditionConflict is true when an older ExternalService claims DnsName or one of AdditionalDnsNames, in which case
+	// DNS is not hijacked to this ExternalService's gateway
+	ConditionConflict = "Conflict"
+	// ConditionCircuitBreakerOverflow is true when gateways rejected connections to the external service because
+	// a circuit breaker was full since the operator last checked. Only reported if the operator checks gateway stats
+	ConditionCircuitBreakerOverflow = "CircuitBreakerOverflow"
+)
+
 // ExternalServiceStatus defines the observed state of ExternalService
 type ExternalServiceStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// Conditions describe the current state of the gateway resources for this ExternalService
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// ObservedGeneration is the most recent generation of the ExternalService reconciled by the operator
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// ReadyReplicas is the number of gateway pods that are ready
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// DesiredReplicas is the number of gateway pods the Deployment is trying to run
+	// +optional
+	DesiredReplicas int32 `json:"desiredReplicas,omitempty"`
+
+	// ClusterIP is the IP address allocated to the gateway Service
+	// +optional
+	ClusterIP string `json:"clusterIP,omitempty"`
+
+	// ConfigHash is the hash of the Envoy configuration currently rolled out to gateway pods,
+	// matching the egress.monzo.com/config-hash annotation
+	// +optional
+	ConfigHash string `json:"configHash,omitempty"`
+
+	// HijackDns mirrors the egress.monzo.com/hijack-dns label on the gateway Service; one of
+	// false, waiting-for-pods or true
+	// +optional
+	HijackDns string `json:"hijackDns,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="DNS Name",type=string,JSONPath=`.spec.dnsName`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Replicas",type=string,JSONPath=`.status.readyReplicas`,priority=1
+// +kubebuilder:printcolumn:name="Cluster IP",type=string,JSONPath=`.status.clusterIP`,priority=1
+// +kubebuilder:printcolumn:name="Hijack",type=string,JSONPath=`.status.hijackDns`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // ExternalService is the Schema for the externalservices API
 type ExternalService struct {
@@ -0,0 +1,802 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// envoyLogLevels are the values accepted by Envoy's --log-level command line option
+var envoyLogLevels = map[string]bool{
+	"trace":    true,
+	"debug":    true,
+	"info":     true,
+	"warning":  true,
+	"warn":     true,
+	"error":    true,
+	"critical": true,
+	"off":      true,
+}
+
+// IsValidEnvoyLogLevel returns true if level can be passed to Envoy's --log-level option
+func IsValidEnvoyLogLevel(level string) bool {
+	return envoyLogLevels[level]
+}
+
+// SetupWebhookWithManager registers the ExternalService admission webhooks with the manager
+func (r *ExternalService) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(&externalServiceDefaulter{}).
+		WithValidator(&externalServiceValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-egress-monzo-com-v1-externalservice,mutating=true,failurePolicy=fail,sideEffects=None,groups=egress.monzo.com,resources=externalservices,verbs=create;update,versions=v1,name=mexternalservice.kb.io,admissionReviewVersions=v1
+
+// externalServiceDefaulter writes the effective value of unset fields into the stored object, so that
+// changing a default in a later operator release doesn't change existing gateways
+// +kubebuilder:object:generate=false
+type externalServiceDefaulter struct{}
+
+var _ admission.CustomDefaulter = &externalServiceDefaulter{}
+
+func (d *externalServiceDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	es, ok := obj.(*ExternalService)
+	if !ok {
+		return fmt.Errorf("expected an ExternalService but got %T", obj)
+	}
+
+	setDefaults(&es.Spec)
+
+	return nil
+}
+
+func setDefaults(spec *ExternalServiceSpec) {
+	if spec.MinReplicas == nil {
+		min := DefaultMinReplicas
+		spec.MinReplicas = &min
+	}
+
+	if spec.MaxReplicas == nil {
+		max := DefaultMaxReplicas
+		spec.MaxReplicas = &max
+	}
+
+	if spec.TargetCPUUtilizationPercentage == nil {
+		target := DefaultTargetCPUUtilizationPercentage
+		spec.TargetCPUUtilizationPercentage = &target
+	}
+
+	if spec.Resources == nil {
+		resources := DefaultResources()
+		spec.Resources = &resources
+	}
+
+	for i := range spec.Ports {
+		if spec.Ports[i].Protocol == nil {
+			p := corev1.ProtocolTCP
+			spec.Ports[i].Protocol = &p
+		}
+	}
+}
+
+// +kubebuilder:webhook:path=/validate-egress-monzo-com-v1-externalservice,mutating=false,failurePolicy=fail,sideEffects=None,groups=egress.monzo.com,resources=externalservices,verbs=create;update,versions=v1,name=vexternalservice.kb.io,admissionReviewVersions=v1
+
+// externalServiceValidator rejects ExternalServices that would produce a broken gateway
+// +kubebuilder:object:generate=false
+type externalServiceValidator struct {
+	Client client.Reader
+}
+
+var _ admission.CustomValidator = &externalServiceValidator{}
+
+func (v *externalServiceValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(ctx, obj)
+}
+
+func (v *externalServiceValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(ctx, newObj)
+}
+
+func (v *externalServiceValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *externalServiceValidator) validate(ctx context.Context, obj runtime.Object) error {
+	es, ok := obj.(*ExternalService)
+	if !ok {
+		return fmt.Errorf("expected an ExternalService but got %T", obj)
+	}
+
+	errs := validateSpec(&es.Spec, field.NewPath("spec"))
+
+	list := &ExternalServiceList{}
+	if err := v.Client.List(ctx, list); err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	errs = append(errs, validateUniqueDnsName(es, list.Items, field.NewPath("spec"))...)
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("ExternalService").GroupKind(), es.Name, errs)
+}
+
+func validateSpec(spec *ExternalServiceSpec, path *field.Path) (errs field.ErrorList) {
+	switch {
+	case spec.DnsName == "":
+		errs = append(errs, field.Required(path.Child("dnsName"), ""))
+	case spec.IsWildcard():
+		for _, msg := range validation.IsWildcardDNS1123Subdomain(spec.DnsName) {
+			errs = append(errs, field.Invalid(path.Child("dnsName"), spec.DnsName, msg))
+		}
+	default:
+		for _, msg := range validation.IsDNS1123Subdomain(spec.DnsName) {
+			errs = append(errs, field.Invalid(path.Child("dnsName"), spec.DnsName, msg))
+		}
+	}
+
+	seen := map[string]bool{strings.ToLower(spec.DnsName): true}
+	for i, name := range spec.AdditionalDnsNames {
+		for _, msg := range validation.IsDNS1123Subdomain(name) {
+			errs = append(errs, field.Invalid(path.Child("additionalDnsNames").Index(i), name, msg))
+		}
+		if seen[strings.ToLower(name)] {
+			errs = append(errs, field.Duplicate(path.Child("additionalDnsNames").Index(i), name))
+		}
+		seen[strings.ToLower(name)] = true
+	}
+
+	errs = append(errs, validatePorts(spec.Ports, path.Child("ports"))...)
+
+	if spec.IsWildcard() {
+		for i, port := range spec.Ports {
+			if port.Protocol != nil && *port.Protocol != corev1.ProtocolTCP {
+				errs = append(errs, field.Invalid(path.Child("ports").Index(i).Child("protocol"), *port.Protocol, "only TCP is supported with a wildcard dnsName"))
+			}
+			if port.IsHTTP() {
+				errs = append(errs, field.Invalid(path.Child("ports").Index(i).Child("mode"), port.Mode, "only TLS is supported with a wildcard dnsName"))
+			}
+			if port.TLS != nil {
+				errs = append(errs, field.Forbidden(path.Child("ports").Index(i).Child("tls"), "cannot be used with a wildcard dnsName"))
+			}
+		}
+		if len(spec.IpOverride) > 0 {
+			errs = append(errs, field.Forbidden(path.Child("ipOverride"), "cannot be used with a wildcard dnsName"))
+		}
+		// The gateway connects to whatever host the SNI names, so it must not be able to escape the wildcard
+		for i, port := range spec.Ports {
+			for j, name := range port.AllowedServerNames {
+				if !matchesDnsNames(spec, name) {
+					errs = append(errs, field.Invalid(path.Child("ports").Index(i).Child("allowedServerNames").Index(j), name,
+						"must be a subdomain of the wildcard dnsName or one of additionalDnsNames"))
+				}
+			}
+		}
+	}
+
+	if spec.ClientCertificate != nil {
+		errs = append(errs, validateClientCertificate(spec, path.Child("clientCertificate"))...)
+	}
+
+	switch spec.DiscoveryType {
+	case "", DiscoveryTypeLogicalDNS, DiscoveryTypeStrictDNS:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("discoveryType"), spec.DiscoveryType,
+			[]string{string(DiscoveryTypeLogicalDNS), string(DiscoveryTypeStrictDNS)}))
+	}
+	switch spec.LbPolicy {
+	case "", LbPolicyRoundRobin, LbPolicyLeastRequest, LbPolicyRandom, LbPolicyRingHash:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("lbPolicy"), spec.LbPolicy,
+			[]string{string(LbPolicyRoundRobin), string(LbPolicyLeastRequest), string(LbPolicyRandom), string(LbPolicyRingHash)}))
+	}
+	if spec.IsWildcard() {
+		if spec.DiscoveryType != "" {
+			errs = append(errs, field.Forbidden(path.Child("discoveryType"), "cannot be used with a wildcard dnsName"))
+		}
+		if spec.LbPolicy != "" {
+			errs = append(errs, field.Forbidden(path.Child("lbPolicy"), "cannot be used with a wildcard dnsName"))
+		}
+	}
+
+	if spec.Connection != nil {
+		errs = append(errs, validateConnectionSettings(spec.Connection, path.Child("connection"))...)
+	}
+
+	if spec.PodTemplate != nil {
+		errs = append(errs, ValidatePodTemplate(spec.PodTemplate.Raw, path.Child("podTemplate"))...)
+	}
+
+	if spec.AccessLog != nil {
+		errs = append(errs, ValidateAccessLog(spec.AccessLog, path.Child("accessLog"))...)
+	}
+
+	if spec.CircuitBreakers != nil {
+		errs = append(errs, validateCircuitBreakers(spec.CircuitBreakers, path.Child("circuitBreakers"))...)
+		if spec.CircuitBreakers.MaxConnections != 0 && spec.EnvoyClusterMaxConnections != nil {
+			errs = append(errs, field.Forbidden(path.Child("circuitBreakers", "maxConnections"), "cannot be used with envoyClusterMaxConnections"))
+		}
+	}
+
+	if spec.HealthCheck != nil {
+		errs = append(errs, validateHealthCheck(spec.HealthCheck, path.Child("healthCheck"))...)
+		if spec.IsWildcard() {
+			errs = append(errs, field.Forbidden(path.Child("healthCheck"), "cannot be used with a wildcard dnsName"))
+		}
+		for _, port := range spec.Ports {
+			if port.Protocol != nil && *port.Protocol != corev1.ProtocolTCP {
+				continue
+			}
+			switch {
+			// HTTP health checks would be sent in plaintext to ports the external service expects clients to speak TLS on
+			case spec.HealthCheck.Type == HealthCheckHTTP && !port.IsHTTP() && port.TLS == nil:
+				errs = append(errs, field.Forbidden(path.Child("healthCheck", "type"), fmt.Sprintf("HTTP health checks require every TCP port to be in http mode or have tls set, and port %d has neither", port.Port)))
+			// TLS health checks would always fail on http mode ports whose upstream connections are plaintext
+			case spec.HealthCheck.Type == HealthCheckTLS && port.IsHTTP() && port.TLS == nil:
+				errs = append(errs, field.Forbidden(path.Child("healthCheck", "type"), fmt.Sprintf("TLS health checks require every http mode port to have tls set, and port %d doesn't", port.Port)))
+			}
+		}
+	}
+
+	if spec.OutlierDetection != nil {
+		errs = append(errs, validateOutlierDetection(spec.OutlierDetection, path.Child("outlierDetection"))...)
+		if spec.IsWildcard() {
+			errs = append(errs, field.Forbidden(path.Child("outlierDetection"), "cannot be used with a wildcard dnsName"))
+		}
+	}
+
+	if spec.MinReplicas != nil && *spec.MinReplicas < 1 {
+		errs = append(errs, field.Invalid(path.Child("minReplicas"), *spec.MinReplicas, "must be at least 1"))
+	}
+	if spec.MaxReplicas != nil && *spec.MaxReplicas < 1 {
+		errs = append(errs, field.Invalid(path.Child("maxReplicas"), *spec.MaxReplicas, "must be at least 1"))
+	}
+	min, max := DefaultMinReplicas, DefaultMaxReplicas
+	if spec.MinReplicas != nil {
+		min = *spec.MinReplicas
+	}
+	if spec.MaxReplicas != nil {
+		max = *spec.MaxReplicas
+	}
+	if min > max {
+		errs = append(errs, field.Invalid(path.Child("minReplicas"), min, fmt.Sprintf("must not be greater than maxReplicas (%d)", max)))
+	}
+
+	if spec.TargetCPUUtilizationPercentage != nil && *spec.TargetCPUUtilizationPercentage < 1 {
+		errs = append(errs, field.Invalid(path.Child("targetCPUUtilizationPercentage"), *spec.TargetCPUUtilizationPercentage, "must be at least 1"))
+	}
+
+	switch spec.IpFamily {
+	case "", IpFamilyIPv4, IpFamilyIPv6, IpFamilyDualStackPreferIPv4, IpFamilyDualStackPreferIPv6:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("ipFamily"), spec.IpFamily,
+			[]string{string(IpFamilyIPv4), string(IpFamilyIPv6), string(IpFamilyDualStackPreferIPv4), string(IpFamilyDualStackPreferIPv6)}))
+	}
+
+	for i, ip := range spec.IpOverride {
+		parsed := net.ParseIP(ip)
+		switch {
+		case parsed == nil:
+			errs = append(errs, field.Invalid(path.Child("ipOverride").Index(i), ip, "must be an IP address"))
+		case parsed.To4() != nil && !spec.IpFamily.HasIPv4():
+			errs = append(errs, field.Invalid(path.Child("ipOverride").Index(i), ip, "must be an IPv6 address when ipFamily is IPv6"))
+		case parsed.To4() == nil && !spec.IpFamily.HasIPv6():
+			errs = append(errs, field.Invalid(path.Child("ipOverride").Index(i), ip, "must be an IPv4 address unless ipFamily includes IPv6"))
+		}
+	}
+
+	if spec.EnvoyLogLevel != "" && !IsValidEnvoyLogLevel(spec.EnvoyLogLevel) {
+		errs = append(errs, field.NotSupported(path.Child("envoyLogLevel"), spec.EnvoyLogLevel,
+			[]string{"trace", "debug", "info", "warning", "warn", "error", "critical", "off"}))
+	}
+
+	if spec.EnvoyDnsRefreshRateS < 0 {
+		errs = append(errs, field.Invalid(path.Child("envoyDnsRefreshRateS"), spec.EnvoyDnsRefreshRateS, "must not be negative"))
+	}
+
+	return errs
+}
+
+func validatePorts(ports []ExternalServicePort, path *field.Path) (errs field.ErrorList) {
+	if len(ports) == 0 {
+		errs = append(errs, field.Required(path, "at least one port must be specified"))
+	}
+
+	seen := map[string]bool{}
+	for i, port := range ports {
+		p := corev1.ProtocolTCP
+		if port.Protocol != nil {
+			p = *port.Protocol
+		}
+
+		switch p {
+		case corev1.ProtocolTCP, corev1.ProtocolUDP:
+		default:
+			errs = append(errs, field.NotSupported(path.Index(i).Child("protocol"), p, []string{string(corev1.ProtocolTCP), string(corev1.ProtocolUDP)}))
+		}
+
+		for _, msg := range validation.IsValidPortNum(int(port.Port)) {
+			errs = append(errs, field.Invalid(path.Index(i).Child("port"), port.Port, msg))
+		}
+
+		for j, name := range port.AllowedServerNames {
+			var msgs []string
+			if strings.HasPrefix(name, "*.") {
+				msgs = validation.IsWildcardDNS1123Subdomain(name)
+			} else {
+				msgs = validation.IsDNS1123Subdomain(name)
+			}
+			for _, msg := range msgs {
+				errs = append(errs, field.Invalid(path.Index(i).Child("allowedServerNames").Index(j), name, msg))
+			}
+		}
+		if len(port.AllowedServerNames) > 0 && p != corev1.ProtocolTCP {
+			errs = append(errs, field.Forbidden(path.Index(i).Child("allowedServerNames"), "only supported on TCP ports"))
+		}
+
+		switch port.Mode {
+		case "", PortModeTCP:
+			if port.HTTP != nil {
+				errs = append(errs, field.Forbidden(path.Index(i).Child("http"), "only supported in http mode"))
+			}
+		case PortModeHTTP:
+			if p != corev1.ProtocolTCP {
+				errs = append(errs, field.Forbidden(path.Index(i).Child("mode"), "http mode is only supported on TCP ports"))
+			}
+			if len(port.AllowedServerNames) > 0 {
+				errs = append(errs, field.Forbidden(path.Index(i).Child("allowedServerNames"), "cannot be used with http mode"))
+			}
+			if port.HTTP != nil {
+				errs = append(errs, validateHTTPPortOptions(port.HTTP, path.Index(i).Child("http"))...)
+			}
+		default:
+			errs = append(errs, field.NotSupported(path.Index(i).Child("mode"), port.Mode, []string{string(PortModeTCP), string(PortModeHTTP)}))
+		}
+
+		if port.TLS != nil {
+			if p != corev1.ProtocolTCP {
+				errs = append(errs, field.Forbidden(path.Index(i).Child("tls"), "only supported on TCP ports"))
+			}
+			if len(port.AllowedServerNames) > 0 {
+				errs = append(errs, field.Forbidden(path.Index(i).Child("allowedServerNames"), "cannot be used with tls, as clients connect in plaintext"))
+			}
+			errs = append(errs, validateTLSOrigination(port.TLS, path.Index(i).Child("tls"))...)
+		}
+
+		if port.Connection != nil {
+			errs = append(errs, validateConnectionSettings(port.Connection, path.Index(i).Child("connection"))...)
+			if port.Connection.MaxConnectAttempts != 0 && (p != corev1.ProtocolTCP || port.IsHTTP()) {
+				errs = append(errs, field.Forbidden(path.Index(i).Child("connection", "maxConnectAttempts"), "only supported on TCP mode ports"))
+			}
+			if port.Connection.MaxClientConnections != 0 && p != corev1.ProtocolTCP {
+				errs = append(errs, field.Forbidden(path.Index(i).Child("connection", "maxClientConnections"), "only supported on TCP ports"))
+			}
+		}
+
+		if port.RateLimit != nil {
+			errs = append(errs, validateRateLimit(port.RateLimit, path.Index(i).Child("rateLimit"))...)
+			if p != corev1.ProtocolTCP {
+				errs = append(errs, field.Forbidden(path.Index(i).Child("rateLimit"), "only supported on TCP ports"))
+			}
+			if port.RateLimit.Requests != nil && !port.IsHTTP() {
+				errs = append(errs, field.Forbidden(path.Index(i).Child("rateLimit", "requests"), "only supported in http mode"))
+			}
+		}
+
+		key := fmt.Sprintf("%s/%d", p, port.Port)
+		if seen[key] {
+			errs = append(errs, field.Duplicate(path.Index(i), key))
+		}
+		seen[key] = true
+	}
+
+	return errs
+}
+
+func validateTLSOrigination(tls *TLSOrigination, path *field.Path) (errs field.ErrorList) {
+	if tls.TargetPort != 0 {
+		for _, msg := range validation.IsValidPortNum(int(tls.TargetPort)) {
+			errs = append(errs, field.Invalid(path.Child("targetPort"), tls.TargetPort, msg))
+		}
+	}
+
+	for _, secret := range []struct {
+		name, value string
+	}{
+		{"caSecretName", tls.CASecretName},
+		{"clientCertificateSecretName", tls.ClientCertificateSecretName},
+	} {
+		if secret.value == "" {
+			continue
+		}
+		for _, msg := range validation.IsDNS1123Subdomain(secret.value) {
+			errs = append(errs, field.Invalid(path.Child(secret.name), secret.value, msg))
+		}
+	}
+
+	return errs
+}
+
+func validateClientCertificate(spec *ExternalServiceSpec, path *field.Path) (errs field.ErrorList) {
+	c := spec.ClientCertificate
+	if c.SecretName == "" && c.Issuer == nil {
+		errs = append(errs, field.Required(path.Child("secretName"), "secretName or issuer must be set"))
+	}
+	if c.SecretName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(c.SecretName) {
+			errs = append(errs, field.Invalid(path.Child("secretName"), c.SecretName, msg))
+		}
+	}
+	if c.Issuer != nil {
+		if c.Issuer.Name == "" {
+			errs = append(errs, field.Required(path.Child("issuer", "name"), ""))
+		}
+		switch c.Issuer.Kind {
+		case "", "Issuer", "ClusterIssuer":
+		default:
+			errs = append(errs, field.NotSupported(path.Child("issuer", "kind"), c.Issuer.Kind, []string{"Issuer", "ClusterIssuer"}))
+		}
+	}
+
+	// A client certificate can only be presented on connections the gateway originates TLS for
+	originates := false
+	for _, port := range spec.Ports {
+		if port.TLS != nil {
+			originates = true
+		}
+	}
+	if !originates {
+		errs = append(errs, field.Invalid(path, "", "requires at least one port with tls set"))
+	}
+
+	return errs
+}
+
+func validateHealthCheck(hc *HealthCheck, path *field.Path) (errs field.ErrorList) {
+	switch hc.Type {
+	case "", HealthCheckTCP, HealthCheckTLS:
+		if hc.Path != "" {
+			errs = append(errs, field.Forbidden(path.Child("path"), "only supported for HTTP health checks"))
+		}
+		if len(hc.ExpectedStatuses) > 0 {
+			errs = append(errs, field.Forbidden(path.Child("expectedStatuses"), "only supported for HTTP health checks"))
+		}
+	case HealthCheckHTTP:
+		if hc.Path != "" && !strings.HasPrefix(hc.Path, "/") {
+			errs = append(errs, field.Invalid(path.Child("path"), hc.Path, "must start with /"))
+		}
+		for i, status := range hc.ExpectedStatuses {
+			if status < 100 || status > 599 {
+				errs = append(errs, field.Invalid(path.Child("expectedStatuses").Index(i), status, "must be between 100 and 599"))
+			}
+		}
+	default:
+		errs = append(errs, field.NotSupported(path.Child("type"), hc.Type, []string{string(HealthCheckTCP), string(HealthCheckHTTP), string(HealthCheckTLS)}))
+	}
+
+	errs = append(errs, validateNotNegative(path, map[string]int32{
+		"intervalSeconds":    hc.IntervalSeconds,
+		"timeoutSeconds":     hc.TimeoutSeconds,
+		"unhealthyThreshold": hc.UnhealthyThreshold,
+		"healthyThreshold":   hc.HealthyThreshold,
+	})...)
+
+	return errs
+}
+
+func validateOutlierDetection(od *OutlierDetection, path *field.Path) (errs field.ErrorList) {
+	errs = append(errs, validateNotNegative(path, map[string]int32{
+		"consecutiveFailures":     od.ConsecutiveFailures,
+		"intervalSeconds":         od.IntervalSeconds,
+		"baseEjectionTimeSeconds": od.BaseEjectionTimeSeconds,
+		"maxEjectionPercent":      od.MaxEjectionPercent,
+	})...)
+
+	if od.MaxEjectionPercent > 100 {
+		errs = append(errs, field.Invalid(path.Child("maxEjectionPercent"), od.MaxEjectionPercent, "must not be greater than 100"))
+	}
+
+	return errs
+}
+
+// ValidateAccessLog checks an access log configuration, which may come from an ExternalService or the operator's default
+func ValidateAccessLog(al *AccessLog, path *field.Path) (errs field.ErrorList) {
+	for name := range al.JsonFormat {
+		if name == "" {
+			errs = append(errs, field.Invalid(path.Child("jsonFormat"), name, "field names must not be empty"))
+		}
+	}
+
+	if f := al.Filter; f != nil {
+		errs = append(errs, validateNotNegative(path.Child("filter"), map[string]int32{
+			"minDurationMilliseconds": f.MinDurationMilliseconds,
+		})...)
+		if f.SamplePercent != nil && (*f.SamplePercent < 0 || *f.SamplePercent > 100) {
+			errs = append(errs, field.Invalid(path.Child("filter", "samplePercent"), *f.SamplePercent, "must be between 0 and 100"))
+		}
+	}
+
+	for i, sink := range al.Sinks {
+		p := path.Child("sinks").Index(i)
+		switch sink.Type {
+		case AccessLogSinkFile:
+			if !strings.HasPrefix(sink.Path, "/") {
+				errs = append(errs, field.Invalid(p.Child("path"), sink.Path, "must be an absolute path"))
+			}
+			if sink.Address != "" {
+				errs = append(errs, field.Forbidden(p.Child("address"), "only supported by GRPC and OpenTelemetry sinks"))
+			}
+		case AccessLogSinkGRPC, AccessLogSinkOpenTelemetry:
+			if sink.Path != "" {
+				errs = append(errs, field.Forbidden(p.Child("path"), "only supported by File sinks"))
+			}
+			host, port, err := net.SplitHostPort(sink.Address)
+			if err != nil || host == "" {
+				errs = append(errs, field.Invalid(p.Child("address"), sink.Address, "must be host:port"))
+				continue
+			}
+			if n, err := strconv.Atoi(port); err != nil || len(validation.IsValidPortNum(n)) > 0 {
+				errs = append(errs, field.Invalid(p.Child("address"), sink.Address, "must have a valid port"))
+			}
+		default:
+			errs = append(errs, field.NotSupported(p.Child("type"), sink.Type,
+				[]string{string(AccessLogSinkFile), string(AccessLogSinkGRPC), string(AccessLogSinkOpenTelemetry)}))
+		}
+	}
+
+	return errs
+}
+
+// GatewayContainerName is the name of the Envoy container in gateway pods
+const GatewayContainerName = "gateway"
+
+// ValidatePodTemplate checks a pod template overlay, which may come from an ExternalService or the operator's default,
+// decodes as a PodTemplateSpec. Unknown fields are allowed, so the overlay can use strategic merge directives. It can't
+// change what the gateway container runs, which would bypass the Envoy image allow-list, nor give pods access to the
+// node: its namespaces, filesystem or ports, or privileges or capabilities beyond the container runtime's defaults.
+func ValidatePodTemplate(overlay []byte, path *field.Path) (errs field.ErrorList) {
+	template := &corev1.PodTemplateSpec{}
+	if err := json.Unmarshal(overlay, template); err != nil {
+		return append(errs, field.Invalid(path, "", fmt.Sprintf("must be a pod template: %v", err)))
+	}
+
+	spec := path.Child("spec")
+	if template.Spec.HostNetwork {
+		errs = append(errs, field.Forbidden(spec.Child("hostNetwork"), "gateway pods can't share the node's namespaces"))
+	}
+	if template.Spec.HostPID {
+		errs = append(errs, field.Forbidden(spec.Child("hostPID"), "gateway pods can't share the node's namespaces"))
+	}
+	if template.Spec.HostIPC {
+		errs = append(errs, field.Forbidden(spec.Child("hostIPC"), "gateway pods can't share the node's namespaces"))
+	}
+	for i, volume := range template.Spec.Volumes {
+		if volume.HostPath != nil {
+			errs = append(errs, field.Forbidden(spec.Child("volumes").Index(i).Child("hostPath"), "gateway pods can't mount the node's filesystem"))
+		}
+	}
+
+	for _, containers := range []struct {
+		name       string
+		containers []corev1.Container
+	}{
+		{"initContainers", template.Spec.InitContainers},
+		{"containers", template.Spec.Containers},
+	} {
+		for i, container := range containers.containers {
+			p := spec.Child(containers.name).Index(i)
+			if container.Name == "" {
+				errs = append(errs, field.Required(p.Child("name"), "containers are merged by name"))
+			}
+			if sc := container.SecurityContext; sc != nil {
+				if sc.Privileged != nil && *sc.Privileged {
+					errs = append(errs, field.Forbidden(p.Child("securityContext", "privileged"), "gateway pods can't run privileged containers"))
+				}
+				if sc.AllowPrivilegeEscalation != nil && *sc.AllowPrivilegeEscalation {
+					errs = append(errs, field.Forbidden(p.Child("securityContext", "allowPrivilegeEscalation"), "gateway pods can't run privileged containers"))
+				}
+				if sc.Capabilities != nil && len(sc.Capabilities.Add) > 0 {
+					errs = append(errs, field.Forbidden(p.Child("securityContext", "capabilities", "add"), "gateway pods can't run privileged containers"))
+				}
+			}
+			for j, port := range container.Ports {
+				if port.HostPort != 0 {
+					errs = append(errs, field.Forbidden(p.Child("ports").Index(j).Child("hostPort"), "gateway pods can't bind the node's ports"))
+				}
+			}
+			if containers.name != "containers" || container.Name != GatewayContainerName {
+				continue
+			}
+			if container.Image != "" {
+				errs = append(errs, field.Forbidden(p.Child("image"), "set envoyImage instead"))
+			}
+			if len(container.Command) > 0 {
+				errs = append(errs, field.Forbidden(p.Child("command"), "the gateway container's command can't be changed"))
+			}
+			if len(container.Args) > 0 {
+				errs = append(errs, field.Forbidden(p.Child("args"), "the gateway container's args can't be changed"))
+			}
+		}
+	}
+
+	return errs
+}
+
+func validateConnectionSettings(c *ConnectionSettings, path *field.Path) (errs field.ErrorList) {
+	errs = append(errs, validateNotNegative(path, map[string]int32{
+		"connectTimeoutSeconds": c.ConnectTimeoutSeconds,
+		"idleTimeoutSeconds":    c.IdleTimeoutSeconds,
+		"maxConnectAttempts":    c.MaxConnectAttempts,
+		"maxClientConnections":  c.MaxClientConnections,
+	})...)
+	if c.TcpKeepalive != nil {
+		errs = append(errs, validateNotNegative(path.Child("tcpKeepalive"), map[string]int32{
+			"probes":          c.TcpKeepalive.Probes,
+			"timeSeconds":     c.TcpKeepalive.TimeSeconds,
+			"intervalSeconds": c.TcpKeepalive.IntervalSeconds,
+		})...)
+	}
+
+	return errs
+}
+
+func validateRateLimit(rl *RateLimit, path *field.Path) (errs field.ErrorList) {
+	if rl.Connections == nil && rl.Requests == nil {
+		errs = append(errs, field.Required(path, "connections or requests must be set"))
+	}
+	for _, bucket := range []struct {
+		name  string
+		value *TokenBucket
+	}{
+		{"connections", rl.Connections},
+		{"requests", rl.Requests},
+	} {
+		if bucket.value == nil {
+			continue
+		}
+		if bucket.value.MaxTokens < 1 {
+			errs = append(errs, field.Invalid(path.Child(bucket.name, "maxTokens"), bucket.value.MaxTokens, "must be at least 1"))
+		}
+		errs = append(errs, validateNotNegative(path.Child(bucket.name), map[string]int32{
+			"tokensPerFill":       bucket.value.TokensPerFill,
+			"fillIntervalSeconds": bucket.value.FillIntervalSeconds,
+		})...)
+	}
+
+	return errs
+}
+
+func validateCircuitBreakers(cb *CircuitBreakers, path *field.Path) (errs field.ErrorList) {
+	errs = append(errs, validateNotNegative(path, map[string]int32{
+		"maxConnections":        cb.MaxConnections,
+		"maxPendingRequests":    cb.MaxPendingRequests,
+		"maxRequests":           cb.MaxRequests,
+		"maxRetries":            cb.MaxRetries,
+		"perHostMaxConnections": cb.PerHostMaxConnections,
+	})...)
+	if cb.RetryBudget != nil {
+		errs = append(errs, validateNotNegative(path.Child("retryBudget"), map[string]int32{
+			"budgetPercent":       cb.RetryBudget.BudgetPercent,
+			"minRetryConcurrency": cb.RetryBudget.MinRetryConcurrency,
+		})...)
+		if cb.RetryBudget.BudgetPercent > 100 {
+			errs = append(errs, field.Invalid(path.Child("retryBudget", "budgetPercent"), cb.RetryBudget.BudgetPercent, "must be at most 100"))
+		}
+		if cb.MaxRetries != 0 {
+			errs = append(errs, field.Forbidden(path.Child("maxRetries"), "cannot be used with retryBudget"))
+		}
+	}
+
+	return errs
+}
+
+// validateNotNegative checks that each of the named fields under path is zero or more
+func validateNotNegative(path *field.Path, fields map[string]int32) (errs field.ErrorList) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if fields[name] < 0 {
+			errs = append(errs, field.Invalid(path.Child(name), fields[name], "must not be negative"))
+		}
+	}
+
+	return errs
+}
+
+var httpMethod = regexp.MustCompile(`^[A-Z]+$`)
+
+func validateHTTPPortOptions(opts *HTTPPortOptions, path *field.Path) (errs field.ErrorList) {
+	for i, method := range opts.AllowedMethods {
+		if !httpMethod.MatchString(method) {
+			errs = append(errs, field.Invalid(path.Child("allowedMethods").Index(i), method, "must be an upper case HTTP method such as GET"))
+		}
+	}
+
+	for i, prefix := range opts.AllowedPathPrefixes {
+		if !strings.HasPrefix(prefix, "/") {
+			errs = append(errs, field.Invalid(path.Child("allowedPathPrefixes").Index(i), prefix, "must start with /"))
+		}
+	}
+
+	return errs
+}
+
+// matchesDnsNames returns true if the server name (which may itself be a wildcard) is covered by the
+// wildcard DnsName or is one of AdditionalDnsNames
+func matchesDnsNames(spec *ExternalServiceSpec, name string) bool {
+	name = strings.ToLower(name)
+	suffix := strings.ToLower(strings.TrimPrefix(spec.DnsName, "*"))
+	if name == strings.ToLower(spec.DnsName) || (len(name) > len(suffix) && strings.HasSuffix(name, suffix)) {
+		return true
+	}
+
+	for _, alias := range spec.AdditionalDnsNames {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateUniqueDnsName rejects es if another ExternalService already claims one of its DNS names, as the
+// CoreDNS plugin can only rewrite a name to a single gateway.
+func validateUniqueDnsName(es *ExternalService, existing []ExternalService, path *field.Path) (errs field.ErrorList) {
+	for _, other := range existing {
+		if other.Name == es.Name {
+			continue
+		}
+		for i, name := range es.Spec.DnsNames() {
+			if name == "" {
+				continue
+			}
+			namePath := path.Child("dnsName")
+			if i > 0 {
+				namePath = path.Child("additionalDnsNames").Index(i - 1)
+			}
+			for _, otherName := range other.Spec.DnsNames() {
+				if strings.EqualFold(otherName, name) {
+					errs = append(errs, field.Duplicate(namePath, fmt.Sprintf("%s (already used by ExternalService %s)", name, other.Name)))
+				}
+			}
+		}
+	}
+
+	return errs
+}
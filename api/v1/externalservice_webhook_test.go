@@ -0,0 +1,533 @@
+package v1
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func Test_validateSpec(t *testing.T) {
+	sctp := corev1.ProtocolSCTP
+	udp := corev1.ProtocolUDP
+	maxConnections := uint32(1024)
+	samplePercent := int32(10)
+	overSamplePercent := int32(101)
+	tests := []struct {
+		name    string
+		spec    ExternalServiceSpec
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			spec: ExternalServiceSpec{
+				DnsName:       "google.com",
+				Ports:         []ExternalServicePort{{Port: 443}, {Port: 443, Protocol: &udp}},
+				MinReplicas:   proto.Int32(2),
+				MaxReplicas:   proto.Int32(4),
+				IpOverride:    []string{"1.2.3.4"},
+				EnvoyLogLevel: "debug",
+			},
+		},
+		{
+			name: "valid wildcard",
+			spec: ExternalServiceSpec{DnsName: "*.s3.eu-west-1.amazonaws.com", Ports: []ExternalServicePort{{Port: 443}}},
+		},
+		{
+			name:    "wildcard not leftmost",
+			spec:    ExternalServiceSpec{DnsName: "s3.*.amazonaws.com", Ports: []ExternalServicePort{{Port: 443}}},
+			wantErr: true,
+		},
+		{
+			name:    "wildcard with udp",
+			spec:    ExternalServiceSpec{DnsName: "*.amazonaws.com", Ports: []ExternalServicePort{{Port: 443, Protocol: &udp}}},
+			wantErr: true,
+		},
+		{
+			name:    "wildcard with ip override",
+			spec:    ExternalServiceSpec{DnsName: "*.amazonaws.com", Ports: []ExternalServicePort{{Port: 443}}, IpOverride: []string{"1.2.3.4"}},
+			wantErr: true,
+		},
+		{
+			name: "additional dns names",
+			spec: ExternalServiceSpec{DnsName: "s3.amazonaws.com", AdditionalDnsNames: []string{"s3.eu-west-1.amazonaws.com"}, Ports: []ExternalServicePort{{Port: 443}}},
+		},
+		{
+			name:    "wildcard additional dns name",
+			spec:    ExternalServiceSpec{DnsName: "s3.amazonaws.com", AdditionalDnsNames: []string{"*.s3.amazonaws.com"}, Ports: []ExternalServicePort{{Port: 443}}},
+			wantErr: true,
+		},
+		{
+			name:    "additional dns name duplicates dns name",
+			spec:    ExternalServiceSpec{DnsName: "s3.amazonaws.com", AdditionalDnsNames: []string{"S3.amazonaws.com"}, Ports: []ExternalServicePort{{Port: 443}}},
+			wantErr: true,
+		},
+		{
+			name: "allowed server names",
+			spec: ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443, AllowedServerNames: []string{"google.com", "*.google.com"}}}},
+		},
+		{
+			name:    "allowed server names on udp",
+			spec:    ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 53, Protocol: &udp, AllowedServerNames: []string{"google.com"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid allowed server name",
+			spec:    ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443, AllowedServerNames: []string{"google_com"}}}},
+			wantErr: true,
+		},
+		{
+			name: "wildcard allowed server names within wildcard",
+			spec: ExternalServiceSpec{DnsName: "*.googleapis.com", Ports: []ExternalServicePort{{Port: 443, AllowedServerNames: []string{"storage.googleapis.com", "*.pubsub.googleapis.com"}}}},
+		},
+		{
+			name:    "wildcard allowed server name outside wildcard",
+			spec:    ExternalServiceSpec{DnsName: "*.googleapis.com", Ports: []ExternalServicePort{{Port: 443, AllowedServerNames: []string{"evil.com"}}}},
+			wantErr: true,
+		},
+		{
+			name: "http mode",
+			spec: ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 80, Mode: PortModeHTTP, HTTP: &HTTPPortOptions{AllowedMethods: []string{"GET"}, AllowedPathPrefixes: []string{"/v1/"}}}}},
+		},
+		{
+			name:    "http mode on udp",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 80, Protocol: &udp, Mode: PortModeHTTP}}},
+			wantErr: true,
+		},
+		{
+			name:    "http options in tcp mode",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 80, HTTP: &HTTPPortOptions{AllowedMethods: []string{"GET"}}}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid http method and prefix",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 80, Mode: PortModeHTTP, HTTP: &HTTPPortOptions{AllowedMethods: []string{"get"}, AllowedPathPrefixes: []string{"v1"}}}}},
+			wantErr: true,
+		},
+		{
+			name:    "wildcard http mode",
+			spec:    ExternalServiceSpec{DnsName: "*.example.com", Ports: []ExternalServicePort{{Port: 80, Mode: PortModeHTTP}}},
+			wantErr: true,
+		},
+		{
+			name: "tls origination",
+			spec: ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 80, TLS: &TLSOrigination{TargetPort: 443, CASecretName: "example-ca", ClientCertificateSecretName: "example-client"}}}},
+		},
+		{
+			name:    "tls origination on udp",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 80, Protocol: &udp, TLS: &TLSOrigination{}}}},
+			wantErr: true,
+		},
+		{
+			name:    "tls origination with invalid target port and secret",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 80, TLS: &TLSOrigination{TargetPort: 70000, CASecretName: "Example_CA"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "wildcard tls origination",
+			spec:    ExternalServiceSpec{DnsName: "*.example.com", Ports: []ExternalServicePort{{Port: 80, TLS: &TLSOrigination{}}}},
+			wantErr: true,
+		},
+		{
+			name: "client certificate from issuer",
+			spec: ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443, TLS: &TLSOrigination{}}}, ClientCertificate: &ClientCertificate{Issuer: &CertificateIssuer{Name: "partners", Kind: "ClusterIssuer"}}},
+		},
+		{
+			name:    "client certificate without tls origination",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, ClientCertificate: &ClientCertificate{SecretName: "example-client"}},
+			wantErr: true,
+		},
+		{
+			name:    "client certificate without secret or issuer",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443, TLS: &TLSOrigination{}}}, ClientCertificate: &ClientCertificate{}},
+			wantErr: true,
+		},
+		{
+			name: "http health check and outlier detection",
+			spec: ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443, TLS: &TLSOrigination{}}, {Port: 80, Mode: PortModeHTTP}}, HealthCheck: &HealthCheck{Type: HealthCheckHTTP, Path: "/health", ExpectedStatuses: []int32{200, 204}}, OutlierDetection: &OutlierDetection{ConsecutiveFailures: 3}},
+		},
+		{
+			name:    "tls health check on plaintext http port",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}, {Port: 80, Mode: PortModeHTTP}}, HealthCheck: &HealthCheck{Type: HealthCheckTLS}},
+			wantErr: true,
+		},
+		{
+			name: "tls health check on tls origination http port",
+			spec: ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}, {Port: 80, Mode: PortModeHTTP, TLS: &TLSOrigination{}}}, HealthCheck: &HealthCheck{Type: HealthCheckTLS}},
+		},
+		{
+			name:    "http health check on tls passthrough port",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 80, Mode: PortModeHTTP}, {Port: 443}}, HealthCheck: &HealthCheck{Type: HealthCheckHTTP}},
+			wantErr: true,
+		},
+		{
+			name:    "tcp health check with path",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, HealthCheck: &HealthCheck{Path: "/health"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid health check thresholds",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, HealthCheck: &HealthCheck{Type: HealthCheckHTTP, ExpectedStatuses: []int32{99}, IntervalSeconds: -1}},
+			wantErr: true,
+		},
+		{
+			name:    "outlier detection ejection percent",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, OutlierDetection: &OutlierDetection{MaxEjectionPercent: 101}},
+			wantErr: true,
+		},
+		{
+			name:    "wildcard health check",
+			spec:    ExternalServiceSpec{DnsName: "*.example.com", Ports: []ExternalServicePort{{Port: 443}}, HealthCheck: &HealthCheck{}},
+			wantErr: true,
+		},
+		{
+			name: "strict dns with ring hash",
+			spec: ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, DiscoveryType: DiscoveryTypeStrictDNS, LbPolicy: LbPolicyRingHash},
+		},
+		{
+			name:    "unknown lb policy",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, LbPolicy: "MAGLEV"},
+			wantErr: true,
+		},
+		{
+			name:    "wildcard strict dns",
+			spec:    ExternalServiceSpec{DnsName: "*.example.com", Ports: []ExternalServicePort{{Port: 443}}, DiscoveryType: DiscoveryTypeStrictDNS},
+			wantErr: true,
+		},
+		{
+			name: "ipv6 override",
+			spec: ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, IpFamily: IpFamilyIPv6, IpOverride: []string{"2001:db8::1"}},
+		},
+		{
+			name: "dual stack override",
+			spec: ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, IpFamily: IpFamilyDualStackPreferIPv6, IpOverride: []string{"192.0.2.1", "2001:db8::1"}},
+		},
+		{
+			name:    "ipv6 override without ipv6 family",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, IpOverride: []string{"2001:db8::1"}},
+			wantErr: true,
+		},
+		{
+			name:    "ipv4 override with ipv6 family",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, IpFamily: IpFamilyIPv6, IpOverride: []string{"192.0.2.1"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown ip family",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, IpFamily: "IPv5"},
+			wantErr: true,
+		},
+		{
+			name: "connection settings",
+			spec: ExternalServiceSpec{
+				DnsName:    "example.com",
+				Ports:      []ExternalServicePort{{Port: 5432, Connection: &ConnectionSettings{IdleTimeoutSeconds: 86400, MaxConnectAttempts: 3}}},
+				Connection: &ConnectionSettings{ConnectTimeoutSeconds: 5, TcpKeepalive: &TcpKeepalive{TimeSeconds: 60}},
+			},
+		},
+		{
+			name:    "negative keepalive",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, Connection: &ConnectionSettings{TcpKeepalive: &TcpKeepalive{Probes: -1}}},
+			wantErr: true,
+		},
+		{
+			name:    "max connect attempts in http mode",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 80, Mode: PortModeHTTP, Connection: &ConnectionSettings{MaxConnectAttempts: 2}}}},
+			wantErr: true,
+		},
+		{
+			name: "circuit breakers",
+			spec: ExternalServiceSpec{
+				DnsName:         "example.com",
+				Ports:           []ExternalServicePort{{Port: 443, Connection: &ConnectionSettings{MaxClientConnections: 100}}},
+				CircuitBreakers: &CircuitBreakers{MaxConnections: 2048, PerHostMaxConnections: 256, RetryBudget: &RetryBudget{BudgetPercent: 25}},
+			},
+		},
+		{
+			name: "circuit breakers with envoyClusterMaxConnections",
+			spec: ExternalServiceSpec{
+				DnsName:                    "example.com",
+				Ports:                      []ExternalServicePort{{Port: 443}},
+				EnvoyClusterMaxConnections: &maxConnections,
+				CircuitBreakers:            &CircuitBreakers{MaxConnections: 2048},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "retry budget over 100",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, CircuitBreakers: &CircuitBreakers{RetryBudget: &RetryBudget{BudgetPercent: 101}}},
+			wantErr: true,
+		},
+		{
+			name:    "udp client connection limit",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 53, Protocol: &udp, Connection: &ConnectionSettings{MaxClientConnections: 10}}}},
+			wantErr: true,
+		},
+		{
+			name: "rate limits",
+			spec: ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{
+				{Port: 443, RateLimit: &RateLimit{Connections: &TokenBucket{MaxTokens: 100, TokensPerFill: 10}}},
+				{Port: 80, Mode: PortModeHTTP, RateLimit: &RateLimit{Requests: &TokenBucket{MaxTokens: 50}}},
+			}},
+		},
+		{
+			name:    "request rate limit in tcp mode",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443, RateLimit: &RateLimit{Requests: &TokenBucket{MaxTokens: 50}}}}},
+			wantErr: true,
+		},
+		{
+			name:    "empty token bucket",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443, RateLimit: &RateLimit{Connections: &TokenBucket{}}}}},
+			wantErr: true,
+		},
+		{
+			name:    "udp rate limit",
+			spec:    ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 53, Protocol: &udp, RateLimit: &RateLimit{Connections: &TokenBucket{MaxTokens: 1}}}}},
+			wantErr: true,
+		},
+		{
+			name: "access log sinks",
+			spec: ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, AccessLog: &AccessLog{
+				TextFormat: "%DOWNSTREAM_REMOTE_ADDRESS% %UPSTREAM_HOST%\n",
+				Sinks: []AccessLogSink{
+					{Type: AccessLogSinkFile, Path: "/var/log/egress.log"},
+					{Type: AccessLogSinkOpenTelemetry, Address: "otel-collector.monitoring:4317"},
+				},
+			}},
+		},
+		{
+			name: "access log sink without port",
+			spec: ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, AccessLog: &AccessLog{
+				Sinks: []AccessLogSink{{Type: AccessLogSinkGRPC, Address: "als.monitoring"}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "relative access log file",
+			spec: ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, AccessLog: &AccessLog{
+				Sinks: []AccessLogSink{{Type: AccessLogSinkFile, Path: "egress.log"}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "access log filter",
+			spec: ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, AccessLog: &AccessLog{
+				Filter: &AccessLogFilter{SamplePercent: &samplePercent, OnlyErrors: true, MinDurationMilliseconds: 500},
+			}},
+		},
+		{
+			name: "access log sample over 100 percent",
+			spec: ExternalServiceSpec{DnsName: "example.com", Ports: []ExternalServicePort{{Port: 443}}, AccessLog: &AccessLog{
+				Filter: &AccessLogFilter{SamplePercent: &overSamplePercent},
+			}},
+			wantErr: true,
+		},
+		{
+			name:    "missing dns name",
+			spec:    ExternalServiceSpec{Ports: []ExternalServicePort{{Port: 443}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid dns name",
+			spec:    ExternalServiceSpec{DnsName: "google_com.", Ports: []ExternalServicePort{{Port: 443}}},
+			wantErr: true,
+		},
+		{
+			name:    "no ports",
+			spec:    ExternalServiceSpec{DnsName: "google.com"},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate ports",
+			spec:    ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}, {Port: 443}}},
+			wantErr: true,
+		},
+		{
+			name:    "port out of range",
+			spec:    ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 70000}}},
+			wantErr: true,
+		},
+		{
+			name:    "sctp",
+			spec:    ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443, Protocol: &sctp}}},
+			wantErr: true,
+		},
+		{
+			name:    "min greater than max",
+			spec:    ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, MinReplicas: proto.Int32(5), MaxReplicas: proto.Int32(4)},
+			wantErr: true,
+		},
+		{
+			name:    "min greater than default max",
+			spec:    ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, MinReplicas: proto.Int32(20)},
+			wantErr: true,
+		},
+		{
+			name:    "malformed ip override",
+			spec:    ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, IpOverride: []string{"1.2.3"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown log level",
+			spec:    ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, EnvoyLogLevel: "verbose"},
+			wantErr: true,
+		},
+		{
+			name: "pod template",
+			spec: ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, PodTemplate: &runtime.RawExtension{
+				Raw: []byte(`{"metadata":{"annotations":{"sidecar.istio.io/inject":"false"}},"spec":{"priorityClassName":"egress","containers":[{"name":"gateway","env":[{"name":"FOO","value":"bar"}]}]}}`),
+			}},
+		},
+		{
+			name: "pod template container without a name",
+			spec: ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, PodTemplate: &runtime.RawExtension{
+				Raw: []byte(`{"spec":{"containers":[{"image":"fluent-bit"}]}}`),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "pod template replacing the gateway image",
+			spec: ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, PodTemplate: &runtime.RawExtension{
+				Raw: []byte(`{"spec":{"containers":[{"name":"gateway","image":"attacker/envoy:latest"}]}}`),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "pod template changing the gateway command",
+			spec: ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, PodTemplate: &runtime.RawExtension{
+				Raw: []byte(`{"spec":{"containers":[{"name":"gateway","command":["/bin/sh"],"args":["-c","id"]}]}}`),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "pod template on the host network",
+			spec: ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, PodTemplate: &runtime.RawExtension{
+				Raw: []byte(`{"spec":{"hostNetwork":true}}`),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "pod template with a privileged sidecar",
+			spec: ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, PodTemplate: &runtime.RawExtension{
+				Raw: []byte(`{"spec":{"containers":[{"name":"debug","image":"busybox","securityContext":{"privileged":true}}]}}`),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "pod template with a hostPath volume",
+			spec: ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, PodTemplate: &runtime.RawExtension{
+				Raw: []byte(`{"spec":{"volumes":[{"name":"root","hostPath":{"path":"/"}}]}}`),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "pod template with a hostPort",
+			spec: ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, PodTemplate: &runtime.RawExtension{
+				Raw: []byte(`{"spec":{"containers":[{"name":"gateway","ports":[{"containerPort":8080,"hostPort":8080}]}]}}`),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "pod template adding capabilities",
+			spec: ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, PodTemplate: &runtime.RawExtension{
+				Raw: []byte(`{"spec":{"containers":[{"name":"debug","image":"busybox","securityContext":{"capabilities":{"add":["SYS_ADMIN"]}}}]}}`),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "pod template allowing privilege escalation",
+			spec: ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, PodTemplate: &runtime.RawExtension{
+				Raw: []byte(`{"spec":{"initContainers":[{"name":"setup","image":"busybox","securityContext":{"allowPrivilegeEscalation":true}}]}}`),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "pod template dropping capabilities",
+			spec: ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, PodTemplate: &runtime.RawExtension{
+				Raw: []byte(`{"spec":{"volumes":[{"name":"cache","emptyDir":{}}],"containers":[{"name":"gateway","securityContext":{"allowPrivilegeEscalation":false,"capabilities":{"drop":["ALL"]}}}]}}`),
+			}},
+		},
+		{
+			name: "malformed pod template",
+			spec: ExternalServiceSpec{DnsName: "google.com", Ports: []ExternalServicePort{{Port: 443}}, PodTemplate: &runtime.RawExtension{
+				Raw: []byte(`{"spec":{"containers":"gateway"}}`),
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateSpec(&tt.spec, field.NewPath("spec"))
+			if (len(errs) > 0) != tt.wantErr {
+				t.Errorf("validateSpec() errors = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateUniqueDnsName(t *testing.T) {
+	es := &ExternalService{
+		ObjectMeta: metav1.ObjectMeta{Name: "google"},
+		Spec:       ExternalServiceSpec{DnsName: "google.com"},
+	}
+
+	existing := []ExternalService{
+		{ObjectMeta: metav1.ObjectMeta{Name: "google"}, Spec: ExternalServiceSpec{DnsName: "google.com"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "bing"}, Spec: ExternalServiceSpec{DnsName: "bing.com"}},
+	}
+	if errs := validateUniqueDnsName(es, existing, field.NewPath("spec")); len(errs) != 0 {
+		t.Errorf("validateUniqueDnsName() errors = %v, want none", errs)
+	}
+
+	existing = append(existing, ExternalService{ObjectMeta: metav1.ObjectMeta{Name: "google-2"}, Spec: ExternalServiceSpec{DnsName: "Google.com"}})
+	if errs := validateUniqueDnsName(es, existing, field.NewPath("spec")); len(errs) != 1 {
+		t.Errorf("validateUniqueDnsName() errors = %v, want one duplicate", errs)
+	}
+
+	existing = []ExternalService{{ObjectMeta: metav1.ObjectMeta{Name: "bing"}, Spec: ExternalServiceSpec{DnsName: "bing.com", AdditionalDnsNames: []string{"www.google.com"}}}}
+	es.Spec.AdditionalDnsNames = []string{"www.google.com"}
+	errs := validateUniqueDnsName(es, existing, field.NewPath("spec"))
+	if len(errs) != 1 || errs[0].Field != "spec.additionalDnsNames[0]" {
+		t.Errorf("validateUniqueDnsName() errors = %v, want one duplicate alias", errs)
+	}
+}
+
+func Test_setDefaults(t *testing.T) {
+	udp := corev1.ProtocolUDP
+	tcp := corev1.ProtocolTCP
+
+	spec := ExternalServiceSpec{
+		DnsName:     "google.com",
+		Ports:       []ExternalServicePort{{Port: 443}, {Port: 53, Protocol: &udp}},
+		MinReplicas: proto.Int32(5),
+		Resources: &corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+		},
+	}
+	setDefaults(&spec)
+
+	want := ExternalServiceSpec{
+		DnsName:                        "google.com",
+		Ports:                          []ExternalServicePort{{Port: 443, Protocol: &tcp}, {Port: 53, Protocol: &udp}},
+		MinReplicas:                    proto.Int32(5),
+		MaxReplicas:                    proto.Int32(DefaultMaxReplicas),
+		TargetCPUUtilizationPercentage: proto.Int32(DefaultTargetCPUUtilizationPercentage),
+		Resources: &corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+		},
+	}
+	if !reflect.DeepEqual(spec, want) {
+		t.Errorf("setDefaults() = %+v, want %+v", spec, want)
+	}
+
+	spec = ExternalServiceSpec{DnsName: "google.com"}
+	setDefaults(&spec)
+	if spec.Resources == nil || !reflect.DeepEqual(*spec.Resources, DefaultResources()) {
+		t.Errorf("setDefaults() resources = %v, want %v", spec.Resources, DefaultResources())
+	}
+}
@@ -0,0 +1,428 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	xdstypev3 "github.com/cncf/xds/go/xds/type/v3"
+	accesslogfilterv3 "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v3"
+	envoyv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoycorev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	filev3 "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/file/v3"
+	grpcalsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/grpc/v3"
+	streamv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/stream/v3"
+	envoytypev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+// openTelemetryAccessLogType is the config type of Envoy's OpenTelemetry access logger. Its Go package depends on
+// the OTLP protos, which we don't vendor, so its config is passed as a TypedStruct that Envoy converts itself.
+const openTelemetryAccessLogType = "type.googleapis.com/envoy.extensions.access_loggers.open_telemetry.v3.OpenTelemetryAccessLogConfig"
+
+func textLogFormat(format string) *envoycorev3.SubstitutionFormatString {
+	return &envoycorev3.SubstitutionFormatString{
+		Format: &envoycorev3.SubstitutionFormatString_TextFormatSource{
+			TextFormatSource: &envoycorev3.DataSource{
+				Specifier: &envoycorev3.DataSource_InlineString{
+					InlineString: format,
+				},
+			},
+		},
+		OmitEmptyValues: true,
+		ContentType:     "application/json; charset=UTF-8",
+	}
+}
+
+func jsonLogFormat(fields *structpb.Struct) *envoycorev3.SubstitutionFormatString {
+	return &envoycorev3.SubstitutionFormatString{
+		Format: &envoycorev3.SubstitutionFormatString_JsonFormat{
+			JsonFormat: fields,
+		},
+		OmitEmptyValues: true,
+		ContentType:     "application/json; charset=UTF-8",
+	}
+}
+
+func getStdoutAccessLog(format *envoycorev3.SubstitutionFormatString) ([]*accesslogfilterv3.AccessLog, error) {
+	ac, err := anypb.New(&streamv3.StdoutAccessLog{
+		AccessLogFormat: &streamv3.StdoutAccessLog_LogFormat{
+			LogFormat: format,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	accessLog := []*accesslogfilterv3.AccessLog{{
+		Name:       "envoy.stdout_access_log",
+		ConfigType: &accesslogfilterv3.AccessLog_TypedConfig{TypedConfig: ac},
+	}}
+
+	return accessLog, nil
+}
+
+func getStdoutTextAccessLog(format string) ([]*accesslogfilterv3.AccessLog, error) {
+	return getStdoutAccessLog(textLogFormat(format))
+}
+
+func getJsonAccessLog() ([]*accesslogfilterv3.AccessLog, error) {
+	return getStdoutAccessLog(jsonLogFormat(jsonLogFields))
+}
+
+// clusterTextLogFormat returns the text access log format for a listener, which only includes the requested
+// server name for listeners which inspect SNI and request details for HTTP listeners
+func clusterTextLogFormat(spec egressv1.ExternalServiceSpec, port egressv1.ExternalServicePort) string {
+	switch {
+	case port.IsHTTP():
+		return ClusterHttpTextLogFormat
+	case len(spec.ServerNames(port)) > 0:
+		return ClusterSniTextLogFormat
+	default:
+		return ClusterTextLogFormat
+	}
+}
+
+// ParseDefaultAccessLog parses and validates the operator-wide access log configuration, a JSON AccessLog set in
+// DEFAULT_ACCESS_LOG. It returns nil if value is empty.
+func ParseDefaultAccessLog(value string) (*egressv1.AccessLog, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	al := &egressv1.AccessLog{}
+	if err := json.Unmarshal([]byte(value), al); err != nil {
+		return nil, fmt.Errorf("invalid DEFAULT_ACCESS_LOG: %w", err)
+	}
+	if errs := egressv1.ValidateAccessLog(al, field.NewPath("DEFAULT_ACCESS_LOG")); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+
+	return al, nil
+}
+
+// withDefaultAccessLog returns an ExternalService's access log configuration, where each of its settings replaces
+// the operator default's
+func withDefaultAccessLog(def, al *egressv1.AccessLog) *egressv1.AccessLog {
+	if def == nil {
+		return al
+	}
+
+	config := *def
+	if al == nil {
+		return &config
+	}
+	if al.TextFormat != "" {
+		config.TextFormat = al.TextFormat
+	}
+	if al.JsonFormat != nil {
+		config.JsonFormat = al.JsonFormat
+	}
+	if al.Sinks != nil {
+		config.Sinks = al.Sinks
+	}
+	if al.Filter != nil {
+		config.Filter = al.Filter
+	}
+	if al.DisableAdminLogs != nil {
+		config.DisableAdminLogs = al.DisableAdminLogs
+	}
+
+	return &config
+}
+
+// accessLogConfig returns the access log configuration for an ExternalService, which the reconciler has already
+// merged with the operator default
+func accessLogConfig(spec egressv1.ExternalServiceSpec) egressv1.AccessLog {
+	if spec.AccessLog == nil {
+		return egressv1.AccessLog{}
+	}
+	return *spec.AccessLog
+}
+
+// getClusterAccessLog returns the access logs for a listener: stdout, followed by any configured sinks. JSON logs
+// include every field unless the fields are configured.
+func getClusterAccessLog(es *egressv1.ExternalService, port egressv1.ExternalServicePort) ([]*accesslogfilterv3.AccessLog, error) {
+	config := accessLogConfig(es.Spec)
+
+	textFormat := clusterTextLogFormat(es.Spec, port)
+	if config.TextFormat != "" {
+		textFormat = config.TextFormat
+		if !strings.HasSuffix(textFormat, "\n") {
+			textFormat += "\n"
+		}
+	}
+
+	var jsonFields *structpb.Struct
+	if es.Spec.JsonClusterAccessLogs {
+		jsonFields = jsonLogFields
+		if config.JsonFormat != nil {
+			jsonFields = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+			for name, value := range config.JsonFormat {
+				jsonFields.Fields[name] = structpb.NewStringValue(value)
+			}
+		}
+	}
+
+	format := textLogFormat(textFormat)
+	if jsonFields != nil {
+		format = jsonLogFormat(jsonFields)
+	}
+
+	accessLog, err := getStdoutAccessLog(format)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sink := range config.Sinks {
+		var log *accesslogfilterv3.AccessLog
+		switch sink.Type {
+		case egressv1.AccessLogSinkFile:
+			log, err = getFileAccessLog(sink, format)
+		case egressv1.AccessLogSinkGRPC:
+			log, err = getGrpcAccessLog(es, port, sink)
+		case egressv1.AccessLogSinkOpenTelemetry:
+			log, err = getOpenTelemetryAccessLog(es, sink, textFormat, jsonFields)
+		default:
+			err = fmt.Errorf("unknown access log sink type %q", sink.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+		accessLog = append(accessLog, log)
+	}
+
+	if filter := accessLogFilter(config.Filter); filter != nil {
+		for _, log := range accessLog {
+			log.Filter = filter
+		}
+	}
+
+	return accessLog, nil
+}
+
+// accessLogFilter returns an Envoy filter matching entries which match every part of f, or nil to log everything.
+// Sampling uses Envoy's default randomness, so HTTP requests are sampled by request ID and each request is either
+// logged to every sink or none.
+func accessLogFilter(f *egressv1.AccessLogFilter) *accesslogfilterv3.AccessLogFilter {
+	if f == nil {
+		return nil
+	}
+
+	var filters []*accesslogfilterv3.AccessLogFilter
+	if f.SamplePercent != nil {
+		filters = append(filters, &accesslogfilterv3.AccessLogFilter{
+			FilterSpecifier: &accesslogfilterv3.AccessLogFilter_RuntimeFilter{
+				RuntimeFilter: &accesslogfilterv3.RuntimeFilter{
+					RuntimeKey: "access_log.sample_percent",
+					PercentSampled: &envoytypev3.FractionalPercent{
+						Numerator:   uint32(*f.SamplePercent),
+						Denominator: envoytypev3.FractionalPercent_HUNDRED,
+					},
+				},
+			},
+		})
+	}
+	if f.OnlyErrors {
+		// A response flag filter without flags matches entries with any flag set
+		filters = append(filters, &accesslogfilterv3.AccessLogFilter{
+			FilterSpecifier: &accesslogfilterv3.AccessLogFilter_ResponseFlagFilter{
+				ResponseFlagFilter: &accesslogfilterv3.ResponseFlagFilter{},
+			},
+		})
+	}
+	if f.MinDurationMilliseconds > 0 {
+		filters = append(filters, &accesslogfilterv3.AccessLogFilter{
+			FilterSpecifier: &accesslogfilterv3.AccessLogFilter_DurationFilter{
+				DurationFilter: &accesslogfilterv3.DurationFilter{
+					Comparison: &accesslogfilterv3.ComparisonFilter{
+						Op: accesslogfilterv3.ComparisonFilter_GE,
+						Value: &envoycorev3.RuntimeUInt32{
+							DefaultValue: uint32(f.MinDurationMilliseconds),
+							RuntimeKey:   "access_log.min_duration_ms",
+						},
+					},
+				},
+			},
+		})
+	}
+
+	switch len(filters) {
+	case 0:
+		return nil
+	case 1:
+		return filters[0]
+	default:
+		return &accesslogfilterv3.AccessLogFilter{
+			FilterSpecifier: &accesslogfilterv3.AccessLogFilter_AndFilter{
+				AndFilter: &accesslogfilterv3.AndFilter{Filters: filters},
+			},
+		}
+	}
+}
+
+func getFileAccessLog(sink egressv1.AccessLogSink, format *envoycorev3.SubstitutionFormatString) (*accesslogfilterv3.AccessLog, error) {
+	ac, err := anypb.New(&filev3.FileAccessLog{
+		Path: sink.Path,
+		AccessLogFormat: &filev3.FileAccessLog_LogFormat{
+			LogFormat: format,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &accesslogfilterv3.AccessLog{
+		Name:       "envoy.access_loggers.file",
+		ConfigType: &accesslogfilterv3.AccessLog_TypedConfig{TypedConfig: ac},
+	}, nil
+}
+
+// accessLogClusterName is the cluster logs are sent to a gRPC or OpenTelemetry sink at address through
+func accessLogClusterName(address string) string {
+	return "access_log_" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, address)
+}
+
+// accessLogClusters returns a cluster for each address the ExternalService's gRPC and OpenTelemetry sinks send to
+func accessLogClusters(es *egressv1.ExternalService) ([]*envoyv3.Cluster, error) {
+	var clusters []*envoyv3.Cluster
+	seen := map[string]bool{}
+	for _, sink := range accessLogConfig(es.Spec).Sinks {
+		if sink.Type != egressv1.AccessLogSinkGRPC && sink.Type != egressv1.AccessLogSinkOpenTelemetry {
+			continue
+		}
+		name := accessLogClusterName(sink.Address)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		cluster, err := generateGrpcCluster(name, sink.Address)
+		if err != nil {
+			return nil, fmt.Errorf("access log sink %s: %w", sink.Address, err)
+		}
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters, nil
+}
+
+// commonGrpcAccessLogConfig sends logs to a collector through its cluster
+func commonGrpcAccessLogConfig(es *egressv1.ExternalService, sink egressv1.AccessLogSink) *grpcalsv3.CommonGrpcAccessLogConfig {
+	logName := sink.LogName
+	if logName == "" {
+		logName = es.Name
+	}
+
+	return &grpcalsv3.CommonGrpcAccessLogConfig{
+		LogName: logName,
+		GrpcService: &envoycorev3.GrpcService{
+			TargetSpecifier: &envoycorev3.GrpcService_EnvoyGrpc_{
+				EnvoyGrpc: &envoycorev3.GrpcService_EnvoyGrpc{
+					ClusterName: accessLogClusterName(sink.Address),
+				},
+			},
+		},
+		TransportApiVersion: envoycorev3.ApiVersion_V3,
+	}
+}
+
+// getGrpcAccessLog sends logs to an Envoy gRPC access log service, which receives HTTP or TCP entries
+// depending on the port's mode
+func getGrpcAccessLog(es *egressv1.ExternalService, port egressv1.ExternalServicePort, sink egressv1.AccessLogSink) (*accesslogfilterv3.AccessLog, error) {
+	common := commonGrpcAccessLogConfig(es, sink)
+
+	if port.IsHTTP() {
+		ac, err := anypb.New(&grpcalsv3.HttpGrpcAccessLogConfig{CommonConfig: common})
+		if err != nil {
+			return nil, err
+		}
+		return &accesslogfilterv3.AccessLog{
+			Name:       "envoy.access_loggers.http_grpc",
+			ConfigType: &accesslogfilterv3.AccessLog_TypedConfig{TypedConfig: ac},
+		}, nil
+	}
+
+	ac, err := anypb.New(&grpcalsv3.TcpGrpcAccessLogConfig{CommonConfig: common})
+	if err != nil {
+		return nil, err
+	}
+	return &accesslogfilterv3.AccessLog{
+		Name:       "envoy.access_loggers.tcp_grpc",
+		ConfigType: &accesslogfilterv3.AccessLog_TypedConfig{TypedConfig: ac},
+	}, nil
+}
+
+// getOpenTelemetryAccessLog sends logs to an OpenTelemetry collector. Text logs become the log record's body, and
+// JSON fields become its attributes.
+func getOpenTelemetryAccessLog(es *egressv1.ExternalService, sink egressv1.AccessLogSink, textFormat string, jsonFields *structpb.Struct) (*accesslogfilterv3.AccessLog, error) {
+	commonJson, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(commonGrpcAccessLogConfig(es, sink))
+	if err != nil {
+		return nil, err
+	}
+	var common map[string]interface{}
+	if err := json.Unmarshal(commonJson, &common); err != nil {
+		return nil, err
+	}
+
+	config := map[string]interface{}{
+		"common_config": common,
+	}
+	if jsonFields == nil {
+		config["body"] = map[string]interface{}{"string_value": strings.TrimSuffix(textFormat, "\n")}
+	} else {
+		names := make([]string, 0, len(jsonFields.Fields))
+		for name := range jsonFields.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var attributes []interface{}
+		for _, name := range names {
+			attributes = append(attributes, map[string]interface{}{
+				"key":   name,
+				"value": map[string]interface{}{"string_value": jsonFields.Fields[name].GetStringValue()},
+			})
+		}
+		config["attributes"] = map[string]interface{}{"values": attributes}
+	}
+
+	value, err := structpb.NewStruct(config)
+	if err != nil {
+		return nil, err
+	}
+	ac, err := anypb.New(&xdstypev3.TypedStruct{
+		TypeUrl: openTelemetryAccessLogType,
+		Value:   value,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &accesslogfilterv3.AccessLog{
+		Name:       "envoy.access_loggers.open_telemetry",
+		ConfigType: &accesslogfilterv3.AccessLog_TypedConfig{TypedConfig: ac},
+	}, nil
+}
+
+func getAdminAccessLog(es *egressv1.ExternalService) ([]*accesslogfilterv3.AccessLog, error) {
+	config := accessLogConfig(es.Spec)
+	if config.DisableAdminLogs != nil && *config.DisableAdminLogs {
+		return nil, nil
+	}
+
+	if es.Spec.JsonAdminAccessLogs {
+		return getJsonAccessLog()
+	}
+	return getStdoutTextAccessLog(AdminTextLogFormat)
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+func Test_withDefaultAccessLog(t *testing.T) {
+	def, err := ParseDefaultAccessLog(`{"textFormat": "%UPSTREAM_HOST%", "sinks": [{"type": "GRPC", "address": "als:9001"}]}`)
+	if err != nil {
+		t.Fatalf("ParseDefaultAccessLog() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		accessLog *egressv1.AccessLog
+		want      *egressv1.AccessLog
+	}{
+		{
+			name: "default",
+			want: &egressv1.AccessLog{
+				TextFormat: "%UPSTREAM_HOST%",
+				Sinks:      []egressv1.AccessLogSink{{Type: egressv1.AccessLogSinkGRPC, Address: "als:9001"}},
+			},
+		},
+		{
+			name:      "spec replaces each setting",
+			accessLog: &egressv1.AccessLog{Sinks: []egressv1.AccessLogSink{}},
+			want: &egressv1.AccessLog{
+				TextFormat: "%UPSTREAM_HOST%",
+				Sinks:      []egressv1.AccessLogSink{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withDefaultAccessLog(def, tt.accessLog); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("withDefaultAccessLog() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ParseDefaultAccessLog_invalid(t *testing.T) {
+	if _, err := ParseDefaultAccessLog(`{"sinks": [{"type": "File", "path": "relative.log"}]}`); err == nil {
+		t.Error("ParseDefaultAccessLog() expected an error for a relative file path")
+	}
+}
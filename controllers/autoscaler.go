@@ -38,17 +38,17 @@ func (r *ExternalServiceReconciler) reconcileAutoscaler(ctx context.Context, req
 func autoscaler(es *egressv1.ExternalService) *autoscalingv1.HorizontalPodAutoscaler {
 	min := es.Spec.MinReplicas
 	if min == nil {
-		min = proto.Int(3)
+		min = proto.Int32(egressv1.DefaultMinReplicas)
 	}
 
 	max := es.Spec.MaxReplicas
 	if max == nil {
-		max = proto.Int(12)
+		max = proto.Int32(egressv1.DefaultMaxReplicas)
 	}
 
 	target := es.Spec.TargetCPUUtilizationPercentage
 	if target == nil {
-		target = proto.Int(50)
+		target = proto.Int32(egressv1.DefaultTargetCPUUtilizationPercentage)
 	}
 
 	return &autoscalingv1.HorizontalPodAutoscaler{
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"context"
+
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+// +kubebuilder:rbac:namespace=egress-operator-system,groups=cert-manager.io,resources=certificates,verbs=get;create;patch
+
+// Certificates are handled as unstructured objects so that cert-manager is only needed in clusters which
+// use it. They aren't watched, as that would fail if the CRD isn't installed.
+var certificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+func (r *ExternalServiceReconciler) reconcileCertificate(ctx context.Context, req ctrl.Request, es *egressv1.ExternalService) error {
+	if es.Spec.ClientCertificate == nil || es.Spec.ClientCertificate.Issuer == nil {
+		return nil
+	}
+
+	desired := certificate(es)
+	if err := ctrl.SetControllerReference(es, desired, r.Scheme); err != nil {
+		return err
+	}
+	c := &unstructured.Unstructured{}
+	c.SetGroupVersionKind(certificateGVK)
+	if err := r.Get(ctx, req.NamespacedName, c); err != nil {
+		if apierrs.IsNotFound(err) {
+			return r.Client.Create(ctx, desired)
+		}
+		return err
+	}
+
+	patched := c.DeepCopy()
+	l := patched.GetLabels()
+	if l == nil {
+		l = map[string]string{}
+	}
+	mergeMap(desired.GetLabels(), l)
+	patched.SetLabels(l)
+	patched.Object["spec"] = desired.Object["spec"]
+
+	return ignoreNotFound(r.patchIfNecessary(ctx, patched, client.MergeFrom(c)))
+}
+
+// certificate requests a client certificate for es from cert-manager
+func certificate(es *egressv1.ExternalService) *unstructured.Unstructured {
+	issuer := es.Spec.ClientCertificate.Issuer
+
+	kind := issuer.Kind
+	if kind == "" {
+		kind = "Issuer"
+	}
+	commonName := issuer.CommonName
+	if commonName == "" {
+		commonName = es.Name
+	}
+
+	c := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"secretName": es.ClientCertificateSecretName(),
+			"commonName": commonName,
+			"usages":     []interface{}{"client auth", "digital signature", "key encipherment"},
+			"issuerRef": map[string]interface{}{
+				"name":  issuer.Name,
+				"kind":  kind,
+				"group": certificateGVK.Group,
+			},
+		},
+	}}
+	c.SetGroupVersionKind(certificateGVK)
+	c.SetName(es.Name)
+	c.SetNamespace(namespace)
+	c.SetLabels(labels(es))
+	c.SetAnnotations(annotations(es))
+
+	return c
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	v1 "github.com/monzo/egress-operator/api/v1"
+)
+
+func Test_certificate(t *testing.T) {
+	es := &v1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "partner",
+		},
+		Spec: v1.ExternalServiceSpec{
+			DnsName: "api.partner.com",
+			Ports: []v1.ExternalServicePort{
+				{Port: 443, TLS: &v1.TLSOrigination{}},
+			},
+			ClientCertificate: &v1.ClientCertificate{
+				Issuer: &v1.CertificateIssuer{Name: "partners", Kind: "ClusterIssuer"},
+			},
+		},
+	}
+
+	c := certificate(es)
+	if c.GetName() != "partner" || c.GetNamespace() != namespace {
+		t.Errorf("certificate() = %s/%s, want %s/partner", c.GetNamespace(), c.GetName(), namespace)
+	}
+
+	spec, _, _ := unstructured.NestedMap(c.Object, "spec")
+	want := map[string]interface{}{
+		"secretName": "partner-client-certificate",
+		"commonName": "partner",
+		"usages":     []interface{}{"client auth", "digital signature", "key encipherment"},
+		"issuerRef": map[string]interface{}{
+			"name":  "partners",
+			"kind":  "ClusterIssuer",
+			"group": "cert-manager.io",
+		},
+	}
+	if !reflect.DeepEqual(spec, want) {
+		t.Errorf("certificate() spec = %v, want %v", spec, want)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"hash/fnv"
+	"path"
 	"strconv"
+	"strings"
 
 	accesslogfilterv3 "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v3"
 	bootstrap "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
@@ -14,10 +16,22 @@ import (
 	envoycorev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	envoyendpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	envoylistener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
-	streamv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/stream/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	aggregatev3 "github.com/envoyproxy/go-control-plane/envoy/extensions/clusters/aggregate/v3"
+	dfpclusterv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/clusters/dynamic_forward_proxy/v3"
+	dfpcommonv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/dynamic_forward_proxy/v3"
+	httpratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/local_ratelimit/v3"
+	routerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
+	tlsinspectorv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/listener/tls_inspector/v3"
+	connectionlimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/connection_limit/v3"
+	hcmv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	networkratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/local_ratelimit/v3"
+	snidfpv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/sni_dynamic_forward_proxy/v3"
 	tcpproxyv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
 	udpproxyv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/udp/udp_proxy/v3"
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	matcherv3 "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	envoytypev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/duration"
@@ -65,8 +79,10 @@ var (
 )
 
 const (
-	ClusterTextLogFormat = "[%START_TIME%] %BYTES_RECEIVED% %BYTES_SENT% %DURATION% \"%DOWNSTREAM_REMOTE_ADDRESS%\" \"%UPSTREAM_HOST%\" \"%UPSTREAM_CLUSTER%\"\n"
-	AdminTextLogFormat   = "[%START_TIME%] \"%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%\" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% \"%REQ(X-FORWARDED-FOR)%\" \"%REQ(USER-AGENT)%\" \"%REQ(X-REQUEST-ID)%\" \"%REQ(:AUTHORITY)%\" \"%UPSTREAM_HOST%\"\n"
+	ClusterTextLogFormat     = "[%START_TIME%] %BYTES_RECEIVED% %BYTES_SENT% %DURATION% \"%DOWNSTREAM_REMOTE_ADDRESS%\" \"%UPSTREAM_HOST%\" \"%UPSTREAM_CLUSTER%\"\n"
+	ClusterSniTextLogFormat  = "[%START_TIME%] %BYTES_RECEIVED% %BYTES_SENT% %DURATION% \"%DOWNSTREAM_REMOTE_ADDRESS%\" \"%UPSTREAM_HOST%\" \"%UPSTREAM_CLUSTER%\" \"%REQUESTED_SERVER_NAME%\"\n"
+	ClusterHttpTextLogFormat = "[%START_TIME%] \"%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%\" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% \"%DOWNSTREAM_REMOTE_ADDRESS%\" \"%REQ(USER-AGENT)%\" \"%REQ(:AUTHORITY)%\" \"%UPSTREAM_HOST%\" \"%UPSTREAM_CLUSTER%\"\n"
+	AdminTextLogFormat       = "[%START_TIME%] \"%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%\" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% \"%REQ(X-FORWARDED-FOR)%\" \"%REQ(USER-AGENT)%\" \"%REQ(X-REQUEST-ID)%\" \"%REQ(:AUTHORITY)%\" \"%UPSTREAM_HOST%\"\n"
 )
 
 func (r *ExternalServiceReconciler) reconcileConfigMap(ctx context.Context, req ctrl.Request, es *egressv1.ExternalService, desired *corev1.ConfigMap) error {
@@ -120,89 +136,158 @@ func adminPort(es *egressv1.ExternalService) int32 {
 	panic("couldn't find a port for admin listener")
 }
 
-func getStdoutTextAccessLog(format string) ([]*accesslogfilterv3.AccessLog, error) {
-	ac, err := anypb.New(&streamv3.StdoutAccessLog{
-		AccessLogFormat: &streamv3.StdoutAccessLog_LogFormat{
-			LogFormat: &envoycorev3.SubstitutionFormatString{
-				Format: &envoycorev3.SubstitutionFormatString_TextFormatSource{
-					TextFormatSource: &envoycorev3.DataSource{
-						Specifier: &envoycorev3.DataSource_InlineString{
-							InlineString: format,
+const (
+	// readyPath is the admin endpoint the kubelet probes for readiness
+	readyPath = "/ready"
+	// adminClusterName is the cluster the restricted admin listener forwards to, which can't clash with the
+	// ExternalService's clusters as they're suffixed with their protocol and port
+	adminClusterName = "envoy_admin"
+)
+
+// restrictedAdminPort is the first free port after the admin port
+func restrictedAdminPort(es *egressv1.ExternalService) int32 {
+	disallowed := map[int32]struct{}{}
+
+	for _, p := range es.Spec.Ports {
+		if p.Protocol == nil || *p.Protocol == corev1.ProtocolTCP {
+			disallowed[p.Port] = struct{}{}
+		}
+	}
+
+	for i := adminPort(es) + 1; i < 32768; i++ {
+		if _, ok := disallowed[i]; !ok {
+			return i
+		}
+	}
+
+	panic("couldn't find a port for restricted admin listener")
+}
+
+// loopbackAddress is where the admin interface listens, so only the gateway itself can reach it
+func loopbackAddress(spec egressv1.ExternalServiceSpec) string {
+	if spec.IpFamily.HasIPv4() {
+		return "127.0.0.1"
+	}
+	return "::1"
+}
+
+// generateAdminCluster routes to the gateway's own admin interface
+func generateAdminCluster(es *egressv1.ExternalService) *envoyv3.Cluster {
+	return &envoyv3.Cluster{
+		Name:                 adminClusterName,
+		ClusterDiscoveryType: &envoyv3.Cluster_Type{Type: envoyv3.Cluster_STATIC},
+		ConnectTimeout:       connectTimeout(egressv1.ConnectionSettings{}),
+		LoadAssignment: &envoyendpoint.ClusterLoadAssignment{
+			ClusterName: adminClusterName,
+			Endpoints: []*envoyendpoint.LocalityLbEndpoints{{
+				LbEndpoints: []*envoyendpoint.LbEndpoint{{
+					HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{
+						Endpoint: &envoyendpoint.Endpoint{
+							Address: &envoycorev3.Address{
+								Address: &envoycorev3.Address_SocketAddress{
+									SocketAddress: &envoycorev3.SocketAddress{
+										Address:  loopbackAddress(es.Spec),
+										Protocol: envoycorev3.SocketAddress_TCP,
+										PortSpecifier: &envoycorev3.SocketAddress_PortValue{
+											PortValue: uint32(adminPort(es)),
+										},
+									},
+								},
+							},
 						},
 					},
-				},
-				OmitEmptyValues: true,
-				ContentType:     "application/json; charset=UTF-8",
-			},
+				}},
+			}},
 		},
-	})
+	}
+}
+
+// generateRestrictedAdminListener exposes only the admin interface's readiness and Prometheus stats endpoints, for
+// the kubelet and scrapers. Everything else, such as /quitquitquit or /config_dump, is only reachable from the pod.
+func generateRestrictedAdminListener(es *egressv1.ExternalService) (*envoylistener.Listener, error) {
+	routerConfig, err := anypb.New(&routerv3.Router{})
 	if err != nil {
 		return nil, err
 	}
-	accessLog := []*accesslogfilterv3.AccessLog{{
-		Name:       "envoy.stdout_access_log",
-		ConfigType: &accesslogfilterv3.AccessLog_TypedConfig{TypedConfig: ac},
-	}}
 
-	return accessLog, nil
-}
-
-func getJsonAccessLog() ([]*accesslogfilterv3.AccessLog, error) {
-	ac, err := anypb.New(&streamv3.StdoutAccessLog{
-		AccessLogFormat: &streamv3.StdoutAccessLog_LogFormat{
-			LogFormat: &envoycorev3.SubstitutionFormatString{
-				Format: &envoycorev3.SubstitutionFormatString_JsonFormat{
-					JsonFormat: jsonLogFields,
+	var routes []*routev3.Route
+	for _, path := range []string{readyPath, statsPath} {
+		routes = append(routes, &routev3.Route{
+			Match: &routev3.RouteMatch{
+				PathSpecifier: &routev3.RouteMatch_Path{Path: path},
+			},
+			Action: &routev3.Route_Route{
+				Route: &routev3.RouteAction{
+					ClusterSpecifier: &routev3.RouteAction_Cluster{Cluster: adminClusterName},
 				},
-				OmitEmptyValues: true,
-				ContentType:     "application/json; charset=UTF-8",
+			},
+		})
+	}
+
+	filterConfig, err := anypb.New(&hcmv3.HttpConnectionManager{
+		CodecType:  hcmv3.HttpConnectionManager_AUTO,
+		StatPrefix: "restricted_admin",
+		RouteSpecifier: &hcmv3.HttpConnectionManager_RouteConfig{
+			RouteConfig: &routev3.RouteConfiguration{
+				Name: "restricted_admin",
+				VirtualHosts: []*routev3.VirtualHost{{
+					Name:    "restricted_admin",
+					Domains: []string{"*"},
+					Routes:  routes,
+				}},
 			},
 		},
+		HttpFilters: []*hcmv3.HttpFilter{{
+			Name: "envoy.filters.http.router",
+			ConfigType: &hcmv3.HttpFilter_TypedConfig{
+				TypedConfig: routerConfig,
+			},
+		}},
 	})
 	if err != nil {
 		return nil, err
 	}
-	accessLog := []*accesslogfilterv3.AccessLog{{
-		Name:       "envoy.stdout_access_log",
-		ConfigType: &accesslogfilterv3.AccessLog_TypedConfig{TypedConfig: ac},
-	}}
 
-	return accessLog, nil
-}
-
-func getClusterAccessLog(es *egressv1.ExternalService) ([]*accesslogfilterv3.AccessLog, error) {
-	if es.Spec.JsonClusterAccessLogs {
-		return getJsonAccessLog()
-	}
-	return getStdoutTextAccessLog(ClusterTextLogFormat)
-}
-
-func getAdminAccessLog(es *egressv1.ExternalService) ([]*accesslogfilterv3.AccessLog, error) {
-	if es.Spec.JsonAdminAccessLogs {
-		return getJsonAccessLog()
-	}
-	return getStdoutTextAccessLog(AdminTextLogFormat)
+	return &envoylistener.Listener{
+		Name: "restricted_admin",
+		Address: &envoycorev3.Address{
+			Address: &envoycorev3.Address_SocketAddress{
+				SocketAddress: &envoycorev3.SocketAddress{
+					Address:    bindAddress(es.Spec),
+					Ipv4Compat: es.Spec.IpFamily.IsDualStack(),
+					Protocol:   envoycorev3.SocketAddress_TCP,
+					PortSpecifier: &envoycorev3.SocketAddress_PortValue{
+						PortValue: uint32(restrictedAdminPort(es)),
+					},
+				},
+			},
+		},
+		FilterChains: []*envoylistener.FilterChain{{
+			Filters: []*envoylistener.Filter{{
+				Name: "envoy.filters.network.http_connection_manager",
+				ConfigType: &envoylistener.Filter_TypedConfig{
+					TypedConfig: filterConfig,
+				},
+			}},
+		}},
+	}, nil
 }
 
-func envoyConfig(es *egressv1.ExternalService) (string, error) {
+// envoyBootstrap is the part of a gateway's configuration which can't change without restarting Envoy
+func envoyBootstrap(es *egressv1.ExternalService) (*bootstrap.Bootstrap, error) {
 	adminAccessLog, err := getAdminAccessLog(es)
 	if err != nil {
-		return "", err
-	}
-
-	clusterAccessLog, err := getClusterAccessLog(es)
-	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	config := bootstrap.Bootstrap{
+	config := &bootstrap.Bootstrap{
 		Node: &envoycorev3.Node{
 			Cluster: es.Name,
 		},
 		Admin: &bootstrap.Admin{
 			Address: &envoycorev3.Address{Address: &envoycorev3.Address_SocketAddress{
 				SocketAddress: &envoycorev3.SocketAddress{
-					Address:  "0.0.0.0",
+					Address:  loopbackAddress(es.Spec),
 					Protocol: envoycorev3.SocketAddress_TCP,
 					PortSpecifier: &envoycorev3.SocketAddress_PortValue{
 						PortValue: uint32(adminPort(es)),
@@ -214,62 +299,30 @@ func envoyConfig(es *egressv1.ExternalService) (string, error) {
 		StaticResources: &bootstrap.Bootstrap_StaticResources{},
 	}
 
+	if prometheusScrapingEnabled() {
+		config.StatsConfig = statsTags(es)
+	}
+
+	return config, nil
+}
+
+// envoyResources returns the clusters and listeners proxying each of the ExternalService's ports, followed by the
+// access log sinks' and tracing collector's clusters and the restricted admin listener
+func envoyResources(es *egressv1.ExternalService) (allClusters []*envoyv3.Cluster, listeners []*envoylistener.Listener, err error) {
 	for _, port := range es.Spec.Ports {
-		var dnsRefreshRate *duration.Duration
-		if es.Spec.EnvoyDnsRefreshRateS != 0 {
-			dnsRefreshRate = &durationpb.Duration{Seconds: es.Spec.EnvoyDnsRefreshRateS}
-		}
 		var clusters []*envoyv3.Cluster
 		protocol := protocolToEnvoy(port.Protocol)
 		name := fmt.Sprintf("%s_%s_%s", es.Name, envoycorev3.SocketAddress_Protocol_name[int32(protocol)], strconv.Itoa(int(port.Port)))
 		clusterNameForListener := name
-		clusters = append(clusters, &envoyv3.Cluster{
-			Name: name,
-			ClusterDiscoveryType: &envoyv3.Cluster_Type{
-				Type: envoyv3.Cluster_LOGICAL_DNS,
-			},
-			ConnectTimeout: &duration.Duration{
-				Seconds: 1,
-			},
-			LbPolicy:        envoyv3.Cluster_ROUND_ROBIN,
-			DnsLookupFamily: envoyv3.Cluster_V4_ONLY,
-			UpstreamConnectionOptions: &envoyv3.UpstreamConnectionOptions{
-				TcpKeepalive: &envoycorev3.TcpKeepalive{
-					KeepaliveProbes:   &wrapperspb.UInt32Value{Value: 3},
-					KeepaliveTime:     &wrapperspb.UInt32Value{Value: 30},
-					KeepaliveInterval: &wrapperspb.UInt32Value{Value: 5},
-				},
-			},
-
-			DnsRefreshRate: dnsRefreshRate,
-			RespectDnsTtl:  es.Spec.EnvoyRespectDnsTTL,
-			LoadAssignment: &envoyendpoint.ClusterLoadAssignment{
-				ClusterName: name,
-				Endpoints: []*envoyendpoint.LocalityLbEndpoints{
-					{
-						LbEndpoints: []*envoyendpoint.LbEndpoint{
-							{
-								HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{
-									Endpoint: &envoyendpoint.Endpoint{
-										Address: &envoycorev3.Address{
-											Address: &envoycorev3.Address_SocketAddress{
-												SocketAddress: &envoycorev3.SocketAddress{
-													Address:  es.Spec.DnsName,
-													Protocol: protocol,
-													PortSpecifier: &envoycorev3.SocketAddress_PortValue{
-														PortValue: uint32(port.Port),
-													},
-												},
-											},
-										},
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-		})
+		if es.Spec.IsWildcard() {
+			cluster, err := generateDynamicForwardProxyCluster(name, es.Spec, port)
+			if err != nil {
+				return nil, nil, err
+			}
+			clusters = append(clusters, cluster)
+		} else {
+			clusters = append(clusters, generateDnsCluster(name, es.Spec, port, protocol))
+		}
 
 		// If we want to override the normal DNS lookup and set the IP address
 		// overwrite the Hosts field with one for each IP
@@ -278,39 +331,76 @@ func envoyConfig(es *egressv1.ExternalService) (string, error) {
 			clusters = append([]*envoyv3.Cluster{overrideCluster}, clusters...)
 			aggregateCluster, err := generateAggregateCluster(fmt.Sprintf("%v-aggregate", name), overrideCluster.Name, name)
 			if err != nil {
-				return "", err
+				return nil, nil, err
 			}
 			// Prepend to list
 			clusters = append([]*envoyv3.Cluster{aggregateCluster}, clusters...)
 			clusterNameForListener = aggregateCluster.Name
 		}
 
-		if es.Spec.EnvoyClusterMaxConnections != nil {
-			cbs := &envoyv3.CircuitBreakers{
-				Thresholds: []*envoyv3.CircuitBreakers_Thresholds{
-					{
-						MaxConnections: &wrappers.UInt32Value{Value: *es.Spec.EnvoyClusterMaxConnections},
-					},
-				},
-				PerHostThresholds: nil,
+		if port.TLS != nil {
+			transportSocket, err := generateUpstreamTlsTransportSocket(es, port.TLS)
+			if err != nil {
+				return nil, nil, err
 			}
+			for _, cluster := range clusters {
+				// Aggregate clusters delegate connections to their member clusters
+				if _, ok := cluster.ClusterDiscoveryType.(*envoyv3.Cluster_ClusterType); !ok {
+					cluster.TransportSocket = transportSocket
+				}
+			}
+		}
+
+		// Aggregate clusters delegate to their member clusters and wildcard dynamic forward proxy clusters pick
+		// their own hosts, so neither can be health checked
+		if protocol == envoycorev3.SocketAddress_TCP {
+			for _, cluster := range clusters {
+				if _, ok := cluster.ClusterDiscoveryType.(*envoyv3.Cluster_ClusterType); ok {
+					continue
+				}
+				if es.Spec.HealthCheck != nil {
+					cluster.HealthChecks = []*envoycorev3.HealthCheck{generateHealthCheck(es.Spec, es.Spec.HealthCheck)}
+					if es.Spec.HealthCheck.Type == egressv1.HealthCheckTLS {
+						match, err := generateHealthCheckTlsTransportSocketMatch(es.Spec)
+						if err != nil {
+							return nil, nil, err
+						}
+						cluster.TransportSocketMatches = []*envoyv3.Cluster_TransportSocketMatch{match}
+					}
+				}
+				if es.Spec.OutlierDetection != nil {
+					cluster.OutlierDetection = generateOutlierDetection(es.Spec.OutlierDetection)
+				}
+			}
+		}
+
+		if cbs := generateCircuitBreakers(es.Spec); cbs != nil {
 			for _, cluster := range clusters {
 				cluster.CircuitBreakers = cbs
 			}
 		}
 
+		clusterAccessLog, err := getClusterAccessLog(es, port)
+		if err != nil {
+			return nil, nil, err
+		}
+
 		var listener *envoylistener.Listener
 		switch protocol {
 		case envoycorev3.SocketAddress_TCP:
-			filterConfig, err := anypb.New(&tcpproxyv3.TcpProxy{
-				AccessLog:  clusterAccessLog,
-				StatPrefix: "tcp_proxy",
-				ClusterSpecifier: &tcpproxyv3.TcpProxy_Cluster{
-					Cluster: clusterNameForListener,
-				},
-			})
+			var filter *envoylistener.Filter
+			if port.IsHTTP() {
+				var tracing *hcmv3.HttpConnectionManager_Tracing
+				tracing, err = generateTracing(es)
+				if err != nil {
+					return nil, nil, err
+				}
+				filter, err = generateHttpConnectionManager(es.Spec, port, clusterNameForListener, clusterAccessLog, tracing)
+			} else {
+				filter, err = generateTcpProxy(es.Spec, port, clusterNameForListener, clusterAccessLog)
+			}
 			if err != nil {
-				return "", err
+				return nil, nil, err
 			}
 
 			listener = &envoylistener.Listener{
@@ -318,28 +408,77 @@ func envoyConfig(es *egressv1.ExternalService) (string, error) {
 				Address: &envoycorev3.Address{
 					Address: &envoycorev3.Address_SocketAddress{
 						SocketAddress: &envoycorev3.SocketAddress{
-							Protocol: protocol,
-							Address:  "0.0.0.0",
+							Protocol:   protocol,
+							Address:    bindAddress(es.Spec),
+							Ipv4Compat: es.Spec.IpFamily.IsDualStack(),
 							PortSpecifier: &envoycorev3.SocketAddress_PortValue{
 								PortValue: uint32(port.Port),
 							}}}},
 				FilterChains: []*envoylistener.FilterChain{{
-					Filters: []*envoylistener.Filter{{
-						Name: "envoy.tcp_proxy",
-						ConfigType: &envoylistener.Filter_TypedConfig{
-							TypedConfig: filterConfig,
-						}}}}},
+					Filters: []*envoylistener.Filter{filter},
+				}},
+			}
+
+			// Only accept TLS connections whose SNI is allowed. For wildcards we also don't know the upstream
+			// hostname until we see the ClientHello, so resolve the SNI on demand.
+			if serverNames := es.Spec.ServerNames(port); len(serverNames) > 0 {
+				tlsInspector, err := generateTlsInspector()
+				if err != nil {
+					return nil, nil, err
+				}
+
+				listener.ListenerFilters = []*envoylistener.ListenerFilter{tlsInspector}
+				listener.FilterChains[0].FilterChainMatch = &envoylistener.FilterChainMatch{
+					ServerNames: serverNames,
+				}
+			}
+			if es.Spec.IsWildcard() {
+				sniFilter, err := generateSniDynamicForwardProxyFilter(es.Spec, port)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				chain := listener.FilterChains[0]
+				chain.Filters = append([]*envoylistener.Filter{sniFilter}, chain.Filters...)
+			}
+			if port.RateLimit != nil && port.RateLimit.Connections != nil {
+				rateLimitFilter, err := generateNetworkRateLimitFilter(port.RateLimit.Connections)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				chain := listener.FilterChains[0]
+				chain.Filters = append([]*envoylistener.Filter{rateLimitFilter}, chain.Filters...)
+			}
+			// Excess connections are closed before any other filter sees them
+			if maxConns := es.Spec.ConnectionFor(port).MaxClientConnections; maxConns != 0 {
+				limitFilter, err := generateConnectionLimitFilter(maxConns)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				chain := listener.FilterChains[0]
+				chain.Filters = append([]*envoylistener.Filter{limitFilter}, chain.Filters...)
 			}
 		case envoycorev3.SocketAddress_UDP:
+			var hashPolicies []*udpproxyv3.UdpProxyConfig_HashPolicy
+			if es.Spec.LbPolicy == egressv1.LbPolicyRingHash {
+				hashPolicies = []*udpproxyv3.UdpProxyConfig_HashPolicy{{
+					PolicySpecifier: &udpproxyv3.UdpProxyConfig_HashPolicy_SourceIp{SourceIp: true},
+				}}
+			}
+
 			filterConfig, err := anypb.New(&udpproxyv3.UdpProxyConfig{
 				AccessLog:  clusterAccessLog,
 				StatPrefix: "udp_proxy",
 				RouteSpecifier: &udpproxyv3.UdpProxyConfig_Cluster{
 					Cluster: name,
 				},
+				HashPolicies: hashPolicies,
+				IdleTimeout:  idleTimeout(es.Spec.ConnectionFor(port)),
 			})
 			if err != nil {
-				return "", err
+				return nil, nil, err
 			}
 
 			listener = &envoylistener.Listener{
@@ -347,8 +486,9 @@ func envoyConfig(es *egressv1.ExternalService) (string, error) {
 				Address: &envoycorev3.Address{
 					Address: &envoycorev3.Address_SocketAddress{
 						SocketAddress: &envoycorev3.SocketAddress{
-							Protocol: protocol,
-							Address:  "0.0.0.0",
+							Protocol:   protocol,
+							Address:    bindAddress(es.Spec),
+							Ipv4Compat: es.Spec.IpFamily.IsDualStack(),
 							PortSpecifier: &envoycorev3.SocketAddress_PortValue{
 								PortValue: uint32(port.Port),
 							}}}},
@@ -361,13 +501,53 @@ func envoyConfig(es *egressv1.ExternalService) (string, error) {
 			}
 		}
 
-		config.StaticResources.Clusters = append(config.StaticResources.Clusters, clusters...)
-		config.StaticResources.Listeners = append(config.StaticResources.Listeners, listener)
+		allClusters = append(allClusters, clusters...)
+		listeners = append(listeners, listener)
 	}
 
+	logClusters, err := accessLogClusters(es)
+	if err != nil {
+		return nil, nil, err
+	}
+	allClusters = append(allClusters, logClusters...)
+	tracingClusters, err := tracingClusters(es)
+	if err != nil {
+		return nil, nil, err
+	}
+	allClusters = append(allClusters, tracingClusters...)
+
+	restrictedAdminListener, err := generateRestrictedAdminListener(es)
+	if err != nil {
+		return nil, nil, err
+	}
+	allClusters = append(allClusters, generateAdminCluster(es))
+	listeners = append(listeners, restrictedAdminListener)
+
+	return allClusters, listeners, nil
+}
+
+// envoyConfig is a gateway's complete configuration, with every listener and cluster in its bootstrap
+func envoyConfig(es *egressv1.ExternalService) (string, error) {
+	config, err := envoyBootstrap(es)
+	if err != nil {
+		return "", err
+	}
+
+	config.StaticResources.Clusters, config.StaticResources.Listeners, err = envoyResources(es)
+	if err != nil {
+		return "", err
+	}
+	if err := validateBootstrap(config); err != nil {
+		return "", err
+	}
+
+	return marshalBootstrap(config)
+}
+
+func marshalBootstrap(config *bootstrap.Bootstrap) (string, error) {
 	m := &jsonpb.Marshaler{}
 
-	json, err := m.MarshalToString(&config)
+	json, err := m.MarshalToString(config)
 	if err != nil {
 		return "", err
 	}
@@ -380,14 +560,19 @@ func envoyConfig(es *egressv1.ExternalService) (string, error) {
 	return string(y), nil
 }
 
-func configmap(es *egressv1.ExternalService) (*corev1.ConfigMap, string, error) {
-	ec, err := envoyConfig(es)
+// configmap holds the gateway's Envoy configuration. With an xDS server, it's only the bootstrap, so the hash only
+// changes, rolling the gateway, if something outside of its listeners and clusters changes.
+func configmap(es *egressv1.ExternalService, xds *XdsServer) (*corev1.ConfigMap, string, error) {
+	var ec string
+	var err error
+	if xds != nil {
+		ec, err = xdsEnvoyConfig(es, xds.Address)
+	} else {
+		ec, err = envoyConfig(es)
+	}
 	if err != nil {
 		return nil, "", err
 	}
-	h := fnv.New32a()
-	h.Write([]byte(ec))
-	sum := h.Sum32()
 
 	return &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
@@ -397,10 +582,145 @@ func configmap(es *egressv1.ExternalService) (*corev1.ConfigMap, string, error)
 			Annotations: annotations(es),
 		},
 		Data: map[string]string{"envoy.yaml": ec},
-	}, fmt.Sprintf("%x", sum), nil
+	}, configHash(ec), nil
+}
+
+func configHash(ec string) string {
+	h := fnv.New32a()
+	h.Write([]byte(ec))
+	return fmt.Sprintf("%x", h.Sum32())
+}
+
+// bindAddress is the wildcard address gateways listen on. Dual-stack gateways listen on IPv6 with IPv4 compatibility,
+// so a single listener accepts both families
+func bindAddress(spec egressv1.ExternalServiceSpec) string {
+	if spec.IpFamily.HasIPv6() {
+		return "::"
+	}
+	return "0.0.0.0"
+}
+
+func dnsLookupFamily(spec egressv1.ExternalServiceSpec) envoyv3.Cluster_DnsLookupFamily {
+	switch spec.IpFamily {
+	case egressv1.IpFamilyIPv6:
+		return envoyv3.Cluster_V6_ONLY
+	case egressv1.IpFamilyDualStackPreferIPv4:
+		return envoyv3.Cluster_V4_PREFERRED
+	case egressv1.IpFamilyDualStackPreferIPv6:
+		return envoyv3.Cluster_AUTO
+	default:
+		return envoyv3.Cluster_V4_ONLY
+	}
+}
+
+func discoveryType(spec egressv1.ExternalServiceSpec) envoyv3.Cluster_DiscoveryType {
+	if spec.DiscoveryType == egressv1.DiscoveryTypeStrictDNS {
+		return envoyv3.Cluster_STRICT_DNS
+	}
+	return envoyv3.Cluster_LOGICAL_DNS
+}
+
+func lbPolicy(spec egressv1.ExternalServiceSpec) envoyv3.Cluster_LbPolicy {
+	switch spec.LbPolicy {
+	case egressv1.LbPolicyLeastRequest:
+		return envoyv3.Cluster_LEAST_REQUEST
+	case egressv1.LbPolicyRandom:
+		return envoyv3.Cluster_RANDOM
+	case egressv1.LbPolicyRingHash:
+		return envoyv3.Cluster_RING_HASH
+	default:
+		return envoyv3.Cluster_ROUND_ROBIN
+	}
+}
+
+// connectTimeout is how long clusters wait to connect to the external service, 1 second unless configured
+func connectTimeout(conn egressv1.ConnectionSettings) *duration.Duration {
+	if conn.ConnectTimeoutSeconds != 0 {
+		return &durationpb.Duration{Seconds: int64(conn.ConnectTimeoutSeconds)}
+	}
+	return &duration.Duration{Seconds: 1}
+}
+
+// upstreamConnectionOptions enables TCP keepalive on connections to the external service, probing after 30s
+// idle every 5s and giving up after 3 probes unless configured otherwise
+func upstreamConnectionOptions(conn egressv1.ConnectionSettings) *envoyv3.UpstreamConnectionOptions {
+	keepalive := egressv1.TcpKeepalive{Probes: 3, TimeSeconds: 30, IntervalSeconds: 5}
+	if conn.TcpKeepalive != nil {
+		if conn.TcpKeepalive.Probes != 0 {
+			keepalive.Probes = conn.TcpKeepalive.Probes
+		}
+		if conn.TcpKeepalive.TimeSeconds != 0 {
+			keepalive.TimeSeconds = conn.TcpKeepalive.TimeSeconds
+		}
+		if conn.TcpKeepalive.IntervalSeconds != 0 {
+			keepalive.IntervalSeconds = conn.TcpKeepalive.IntervalSeconds
+		}
+	}
+
+	return &envoyv3.UpstreamConnectionOptions{
+		TcpKeepalive: &envoycorev3.TcpKeepalive{
+			KeepaliveProbes:   &wrapperspb.UInt32Value{Value: uint32(keepalive.Probes)},
+			KeepaliveTime:     &wrapperspb.UInt32Value{Value: uint32(keepalive.TimeSeconds)},
+			KeepaliveInterval: &wrapperspb.UInt32Value{Value: uint32(keepalive.IntervalSeconds)},
+		},
+	}
+}
+
+func generateDnsCluster(name string, spec egressv1.ExternalServiceSpec, port egressv1.ExternalServicePort, protocol envoycorev3.SocketAddress_Protocol) *envoyv3.Cluster {
+	conn := spec.ConnectionFor(port)
+	var dnsRefreshRate *duration.Duration
+	if spec.EnvoyDnsRefreshRateS != 0 {
+		dnsRefreshRate = &durationpb.Duration{Seconds: spec.EnvoyDnsRefreshRateS}
+	}
+
+	return &envoyv3.Cluster{
+		Name: name,
+		ClusterDiscoveryType: &envoyv3.Cluster_Type{
+			Type: discoveryType(spec),
+		},
+		ConnectTimeout:            connectTimeout(conn),
+		LbPolicy:                  lbPolicy(spec),
+		DnsLookupFamily:           dnsLookupFamily(spec),
+		UpstreamConnectionOptions: upstreamConnectionOptions(conn),
+
+		DnsRefreshRate: dnsRefreshRate,
+		RespectDnsTtl:  spec.EnvoyRespectDnsTTL,
+		LoadAssignment: &envoyendpoint.ClusterLoadAssignment{
+			ClusterName: name,
+			Endpoints: []*envoyendpoint.LocalityLbEndpoints{
+				{
+					LbEndpoints: []*envoyendpoint.LbEndpoint{
+						{
+							HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{
+								Endpoint: &envoyendpoint.Endpoint{
+									Address: &envoycorev3.Address{
+										Address: &envoycorev3.Address_SocketAddress{
+											SocketAddress: &envoycorev3.SocketAddress{
+												Address:  spec.DnsName,
+												Protocol: protocol,
+												PortSpecifier: &envoycorev3.SocketAddress_PortValue{
+													PortValue: uint32(port.UpstreamPort()),
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
 }
 
 func generateOverrideCluster(name string, spec egressv1.ExternalServiceSpec, port egressv1.ExternalServicePort, protocol envoycorev3.SocketAddress_Protocol) *envoyv3.Cluster {
+	conn := spec.ConnectionFor(port)
+	// Overridden IPs have never had keepalive enabled by default, so only enable it if asked to
+	var upstreamOptions *envoyv3.UpstreamConnectionOptions
+	if conn.TcpKeepalive != nil {
+		upstreamOptions = upstreamConnectionOptions(conn)
+	}
 	overrideClusterName := fmt.Sprintf("%v-override", name)
 	var dnsRefreshRate *duration.Duration
 	if spec.EnvoyDnsRefreshRateS != 0 {
@@ -415,7 +735,7 @@ func generateOverrideCluster(name string, spec egressv1.ExternalServiceSpec, por
 					HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{
 						Endpoint: &envoyendpoint.Endpoint{
 							HealthCheckConfig: &envoyendpoint.Endpoint_HealthCheckConfig{
-								PortValue: uint32(port.Port),
+								PortValue: uint32(port.UpstreamPort()),
 							},
 							Address: &envoycorev3.Address{
 								Address: &envoycorev3.Address_SocketAddress{
@@ -423,7 +743,7 @@ func generateOverrideCluster(name string, spec egressv1.ExternalServiceSpec, por
 										Address:  ip,
 										Protocol: protocol,
 										PortSpecifier: &envoycorev3.SocketAddress_PortValue{
-											PortValue: uint32(port.Port),
+											PortValue: uint32(port.UpstreamPort()),
 										},
 									},
 								},
@@ -439,27 +759,15 @@ func generateOverrideCluster(name string, spec egressv1.ExternalServiceSpec, por
 		ClusterDiscoveryType: &envoyv3.Cluster_Type{
 			Type: envoyv3.Cluster_STATIC,
 		},
-		ConnectTimeout: &duration.Duration{
-			Seconds: 1,
-		},
+		ConnectTimeout:                      connectTimeout(conn),
 		CloseConnectionsOnHostHealthFailure: true,
+		// Overridden IPs are always health checked, with the user's settings if there are any
 		HealthChecks: []*envoycorev3.HealthCheck{
-			{
-				Timeout: &duration.Duration{
-					Seconds: 1,
-				},
-				Interval: &duration.Duration{
-					Seconds: 10,
-				},
-				ReuseConnection:    wrapperspb.Bool(false),
-				UnhealthyThreshold: wrapperspb.UInt32(2),
-				HealthyThreshold:   wrapperspb.UInt32(3),
-				EventLogPath:       "/dev/stdout",
-				HealthChecker:      &envoycorev3.HealthCheck_TcpHealthCheck_{},
-			},
+			generateHealthCheck(spec, &egressv1.HealthCheck{}),
 		},
-		LbPolicy:        envoyv3.Cluster_ROUND_ROBIN,
-		DnsLookupFamily: envoyv3.Cluster_V4_ONLY,
+		LbPolicy:                  lbPolicy(spec),
+		DnsLookupFamily:           dnsLookupFamily(spec),
+		UpstreamConnectionOptions: upstreamOptions,
 		LoadAssignment: &envoyendpoint.ClusterLoadAssignment{
 			ClusterName: overrideClusterName,
 			Endpoints:   endpoints,
@@ -470,6 +778,540 @@ func generateOverrideCluster(name string, spec egressv1.ExternalServiceSpec, por
 	}
 }
 
+// generateUpstreamTlsTransportSocket originates TLS to the external service, verifying that its certificate is
+// valid for DnsName and chains to the configured CA bundle
+func generateUpstreamTlsTransportSocket(es *egressv1.ExternalService, origination *egressv1.TLSOrigination) (*envoycorev3.TransportSocket, error) {
+	trustedCa := systemCABundle
+	if origination.CASecretName != "" {
+		trustedCa = path.Join(tlsSecretPath(origination.CASecretName), "ca.crt")
+	}
+
+	commonTlsContext := &tlsv3.CommonTlsContext{
+		ValidationContextType: &tlsv3.CommonTlsContext_ValidationContext{
+			ValidationContext: &tlsv3.CertificateValidationContext{
+				TrustedCa: &envoycorev3.DataSource{
+					Specifier: &envoycorev3.DataSource_Filename{Filename: trustedCa},
+				},
+				MatchTypedSubjectAltNames: []*tlsv3.SubjectAltNameMatcher{{
+					SanType: tlsv3.SubjectAltNameMatcher_DNS,
+					Matcher: &matcherv3.StringMatcher{
+						MatchPattern: &matcherv3.StringMatcher_Exact{Exact: es.Spec.DnsName},
+					},
+				}},
+			},
+		},
+	}
+
+	if secretName := clientCertificateSecretName(es, origination); secretName != "" {
+		dir := tlsSecretPath(secretName)
+		commonTlsContext.TlsCertificates = []*tlsv3.TlsCertificate{{
+			CertificateChain: &envoycorev3.DataSource{
+				Specifier: &envoycorev3.DataSource_Filename{Filename: path.Join(dir, corev1.TLSCertKey)},
+			},
+			PrivateKey: &envoycorev3.DataSource{
+				Specifier: &envoycorev3.DataSource_Filename{Filename: path.Join(dir, corev1.TLSPrivateKeyKey)},
+			},
+		}}
+	}
+
+	tlsContext, err := anypb.New(&tlsv3.UpstreamTlsContext{
+		Sni:              es.Spec.DnsName,
+		CommonTlsContext: commonTlsContext,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoycorev3.TransportSocket{
+		Name: "envoy.transport_sockets.tls",
+		ConfigType: &envoycorev3.TransportSocket_TypedConfig{
+			TypedConfig: tlsContext,
+		},
+	}, nil
+}
+
+// healthCheckTlsMatch selects the TLS transport socket for TLS health checks, while proxied connections
+// don't match it and use the cluster's own transport socket
+var healthCheckTlsMatch = &structpb.Struct{
+	Fields: map[string]*structpb.Value{
+		"egress.monzo.com/health-check": structpb.NewStringValue("tls"),
+	},
+}
+
+// generateHealthCheck configures an active health check, filling in defaults for unset fields
+func generateHealthCheck(spec egressv1.ExternalServiceSpec, hc *egressv1.HealthCheck) *envoycorev3.HealthCheck {
+	orDefault := func(v, d int32) int32 {
+		if v == 0 {
+			return d
+		}
+		return v
+	}
+
+	healthCheck := &envoycorev3.HealthCheck{
+		Timeout: &duration.Duration{
+			Seconds: int64(orDefault(hc.TimeoutSeconds, 1)),
+		},
+		Interval: &duration.Duration{
+			Seconds: int64(orDefault(hc.IntervalSeconds, 10)),
+		},
+		ReuseConnection:    wrapperspb.Bool(false),
+		UnhealthyThreshold: wrapperspb.UInt32(uint32(orDefault(hc.UnhealthyThreshold, 2))),
+		HealthyThreshold:   wrapperspb.UInt32(uint32(orDefault(hc.HealthyThreshold, 3))),
+		EventLogPath:       "/dev/stdout",
+		HealthChecker:      &envoycorev3.HealthCheck_TcpHealthCheck_{},
+	}
+
+	switch hc.Type {
+	case egressv1.HealthCheckHTTP:
+		path := hc.Path
+		if path == "" {
+			path = "/"
+		}
+		var expectedStatuses []*envoytypev3.Int64Range
+		for _, status := range hc.ExpectedStatuses {
+			expectedStatuses = append(expectedStatuses, &envoytypev3.Int64Range{Start: int64(status), End: int64(status) + 1})
+		}
+		healthCheck.HealthChecker = &envoycorev3.HealthCheck_HttpHealthCheck_{
+			HttpHealthCheck: &envoycorev3.HealthCheck_HttpHealthCheck{
+				Host:             spec.DnsName,
+				Path:             path,
+				ExpectedStatuses: expectedStatuses,
+			},
+		}
+	case egressv1.HealthCheckTLS:
+		healthCheck.TransportSocketMatchCriteria = healthCheckTlsMatch
+	}
+
+	return healthCheck
+}
+
+// generateHealthCheckTlsTransportSocketMatch completes a TLS handshake with DnsName as the SNI for TLS health
+// checks. The certificate isn't verified, the check is only that the external service speaks TLS.
+func generateHealthCheckTlsTransportSocketMatch(spec egressv1.ExternalServiceSpec) (*envoyv3.Cluster_TransportSocketMatch, error) {
+	tlsContext, err := anypb.New(&tlsv3.UpstreamTlsContext{
+		Sni: spec.DnsName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoyv3.Cluster_TransportSocketMatch{
+		Name:  "health_check_tls",
+		Match: healthCheckTlsMatch,
+		TransportSocket: &envoycorev3.TransportSocket{
+			Name: "envoy.transport_sockets.tls",
+			ConfigType: &envoycorev3.TransportSocket_TypedConfig{
+				TypedConfig: tlsContext,
+			},
+		},
+	}, nil
+}
+
+// generateOutlierDetection ejects hosts after consecutive failures, leaving unset fields to Envoy's defaults
+func generateOutlierDetection(od *egressv1.OutlierDetection) *envoyv3.OutlierDetection {
+	outlierDetection := &envoyv3.OutlierDetection{}
+	if od.ConsecutiveFailures != 0 {
+		outlierDetection.Consecutive_5Xx = wrapperspb.UInt32(uint32(od.ConsecutiveFailures))
+	}
+	if od.IntervalSeconds != 0 {
+		outlierDetection.Interval = &duration.Duration{Seconds: int64(od.IntervalSeconds)}
+	}
+	if od.BaseEjectionTimeSeconds != 0 {
+		outlierDetection.BaseEjectionTime = &duration.Duration{Seconds: int64(od.BaseEjectionTimeSeconds)}
+	}
+	if od.MaxEjectionPercent != 0 {
+		outlierDetection.MaxEjectionPercent = wrapperspb.UInt32(uint32(od.MaxEjectionPercent))
+	}
+
+	return outlierDetection
+}
+
+// generateCircuitBreakers returns the thresholds from CircuitBreakers, or nil to use Envoy's defaults.
+// EnvoyClusterMaxConnections is still honoured for gateways which predate CircuitBreakers.
+func generateCircuitBreakers(spec egressv1.ExternalServiceSpec) *envoyv3.CircuitBreakers {
+	uint32Value := func(v int32) *wrappers.UInt32Value {
+		if v == 0 {
+			return nil
+		}
+		return &wrappers.UInt32Value{Value: uint32(v)}
+	}
+
+	thresholds := &envoyv3.CircuitBreakers_Thresholds{}
+	if spec.EnvoyClusterMaxConnections != nil {
+		thresholds.MaxConnections = &wrappers.UInt32Value{Value: *spec.EnvoyClusterMaxConnections}
+	}
+
+	cb := spec.CircuitBreakers
+	if cb == nil {
+		if thresholds.MaxConnections == nil {
+			return nil
+		}
+		return &envoyv3.CircuitBreakers{Thresholds: []*envoyv3.CircuitBreakers_Thresholds{thresholds}}
+	}
+
+	if cb.MaxConnections != 0 {
+		thresholds.MaxConnections = uint32Value(cb.MaxConnections)
+	}
+	thresholds.MaxPendingRequests = uint32Value(cb.MaxPendingRequests)
+	thresholds.MaxRequests = uint32Value(cb.MaxRequests)
+	thresholds.MaxRetries = uint32Value(cb.MaxRetries)
+	if cb.RetryBudget != nil {
+		thresholds.RetryBudget = &envoyv3.CircuitBreakers_Thresholds_RetryBudget{
+			MinRetryConcurrency: uint32Value(cb.RetryBudget.MinRetryConcurrency),
+		}
+		if cb.RetryBudget.BudgetPercent != 0 {
+			thresholds.RetryBudget.BudgetPercent = &envoytypev3.Percent{Value: float64(cb.RetryBudget.BudgetPercent)}
+		}
+	}
+
+	cbs := &envoyv3.CircuitBreakers{Thresholds: []*envoyv3.CircuitBreakers_Thresholds{thresholds}}
+	if cb.PerHostMaxConnections != 0 {
+		cbs.PerHostThresholds = []*envoyv3.CircuitBreakers_Thresholds{{
+			MaxConnections: uint32Value(cb.PerHostMaxConnections),
+		}}
+	}
+	return cbs
+}
+
+// generateConnectionLimitFilter limits how many client connections a listener has open at once
+func generateConnectionLimitFilter(maxConns int32) (*envoylistener.Filter, error) {
+	filterConfig, err := anypb.New(&connectionlimitv3.ConnectionLimit{
+		StatPrefix:     "connection_limit",
+		MaxConnections: &wrappers.UInt64Value{Value: uint64(maxConns)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoylistener.Filter{
+		Name: "envoy.filters.network.connection_limit",
+		ConfigType: &envoylistener.Filter_TypedConfig{
+			TypedConfig: filterConfig,
+		},
+	}, nil
+}
+
+func generateTokenBucket(bucket *egressv1.TokenBucket) *envoytypev3.TokenBucket {
+	tokensPerFill := uint32(1)
+	if bucket.TokensPerFill != 0 {
+		tokensPerFill = uint32(bucket.TokensPerFill)
+	}
+	fillInterval := int64(1)
+	if bucket.FillIntervalSeconds != 0 {
+		fillInterval = int64(bucket.FillIntervalSeconds)
+	}
+
+	return &envoytypev3.TokenBucket{
+		MaxTokens:     uint32(bucket.MaxTokens),
+		TokensPerFill: &wrappers.UInt32Value{Value: tokensPerFill},
+		FillInterval:  &durationpb.Duration{Seconds: fillInterval},
+	}
+}
+
+// generateNetworkRateLimitFilter closes new connections once the token bucket is empty
+func generateNetworkRateLimitFilter(bucket *egressv1.TokenBucket) (*envoylistener.Filter, error) {
+	filterConfig, err := anypb.New(&networkratelimitv3.LocalRateLimit{
+		StatPrefix:  "local_rate_limit",
+		TokenBucket: generateTokenBucket(bucket),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoylistener.Filter{
+		Name: "envoy.filters.network.local_ratelimit",
+		ConfigType: &envoylistener.Filter_TypedConfig{
+			TypedConfig: filterConfig,
+		},
+	}, nil
+}
+
+// generateHttpRateLimitFilter answers requests with a 429 once the token bucket is empty. The filter does nothing
+// unless it's both enabled and enforced for a share of requests, so do both for all of them.
+func generateHttpRateLimitFilter(bucket *egressv1.TokenBucket) (*hcmv3.HttpFilter, error) {
+	allRequests := func(key string) *envoycorev3.RuntimeFractionalPercent {
+		return &envoycorev3.RuntimeFractionalPercent{
+			DefaultValue: &envoytypev3.FractionalPercent{
+				Numerator:   100,
+				Denominator: envoytypev3.FractionalPercent_HUNDRED,
+			},
+			RuntimeKey: key,
+		}
+	}
+
+	filterConfig, err := anypb.New(&httpratelimitv3.LocalRateLimit{
+		StatPrefix:     "http_local_rate_limit",
+		TokenBucket:    generateTokenBucket(bucket),
+		FilterEnabled:  allRequests("local_rate_limit_enabled"),
+		FilterEnforced: allRequests("local_rate_limit_enforced"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &hcmv3.HttpFilter{
+		Name: "envoy.filters.http.local_ratelimit",
+		ConfigType: &hcmv3.HttpFilter_TypedConfig{
+			TypedConfig: filterConfig,
+		},
+	}, nil
+}
+
+// idleTimeout is the configured idle timeout for a port, or nil to use Envoy's default
+func idleTimeout(conn egressv1.ConnectionSettings) *duration.Duration {
+	if conn.IdleTimeoutSeconds == 0 {
+		return nil
+	}
+	return &durationpb.Duration{Seconds: int64(conn.IdleTimeoutSeconds)}
+}
+
+func generateTcpProxy(spec egressv1.ExternalServiceSpec, port egressv1.ExternalServicePort, cluster string, accessLog []*accesslogfilterv3.AccessLog) (*envoylistener.Filter, error) {
+	conn := spec.ConnectionFor(port)
+	var maxConnectAttempts *wrappers.UInt32Value
+	if conn.MaxConnectAttempts != 0 {
+		maxConnectAttempts = &wrappers.UInt32Value{Value: uint32(conn.MaxConnectAttempts)}
+	}
+
+	// Ring hash balancing keeps each client on the same upstream host
+	var hashPolicy []*envoytypev3.HashPolicy
+	if spec.LbPolicy == egressv1.LbPolicyRingHash {
+		hashPolicy = []*envoytypev3.HashPolicy{{
+			PolicySpecifier: &envoytypev3.HashPolicy_SourceIp_{
+				SourceIp: &envoytypev3.HashPolicy_SourceIp{},
+			},
+		}}
+	}
+
+	filterConfig, err := anypb.New(&tcpproxyv3.TcpProxy{
+		AccessLog:  accessLog,
+		StatPrefix: "tcp_proxy",
+		ClusterSpecifier: &tcpproxyv3.TcpProxy_Cluster{
+			Cluster: cluster,
+		},
+		HashPolicy:         hashPolicy,
+		IdleTimeout:        idleTimeout(conn),
+		MaxConnectAttempts: maxConnectAttempts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoylistener.Filter{
+		Name: "envoy.tcp_proxy",
+		ConfigType: &envoylistener.Filter_TypedConfig{
+			TypedConfig: filterConfig,
+		},
+	}, nil
+}
+
+// commonHttpProtocolOptions closes idle client connections of http mode ports, if an idle timeout is set
+func commonHttpProtocolOptions(conn egressv1.ConnectionSettings) *envoycorev3.HttpProtocolOptions {
+	if conn.IdleTimeoutSeconds == 0 {
+		return nil
+	}
+	return &envoycorev3.HttpProtocolOptions{IdleTimeout: idleTimeout(conn)}
+}
+
+// generateHttpConnectionManager proxies plaintext HTTP requests for the ExternalService's names to cluster,
+// optionally only for some methods and path prefixes. Any other request gets a 403 from the gateway. Requests are
+// traced if tracing is set.
+func generateHttpConnectionManager(spec egressv1.ExternalServiceSpec, port egressv1.ExternalServicePort, cluster string, accessLog []*accesslogfilterv3.AccessLog, tracing *hcmv3.HttpConnectionManager_Tracing) (*envoylistener.Filter, error) {
+	routerConfig, err := anypb.New(&routerv3.Router{})
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes := []string{"/"}
+	var methods []*routev3.HeaderMatcher
+	if port.HTTP != nil {
+		if len(port.HTTP.AllowedPathPrefixes) > 0 {
+			prefixes = port.HTTP.AllowedPathPrefixes
+		}
+		if len(port.HTTP.AllowedMethods) > 0 {
+			methods = []*routev3.HeaderMatcher{{
+				Name: ":method",
+				HeaderMatchSpecifier: &routev3.HeaderMatcher_StringMatch{
+					StringMatch: &matcherv3.StringMatcher{
+						MatchPattern: &matcherv3.StringMatcher_SafeRegex{
+							SafeRegex: &matcherv3.RegexMatcher{
+								Regex: strings.Join(port.HTTP.AllowedMethods, "|"),
+							},
+						},
+					},
+				},
+			}}
+		}
+	}
+
+	forbidden := &routev3.Route{
+		Match: &routev3.RouteMatch{
+			PathSpecifier: &routev3.RouteMatch_Prefix{Prefix: "/"},
+		},
+		Action: &routev3.Route_DirectResponse{
+			DirectResponse: &routev3.DirectResponseAction{Status: 403},
+		},
+	}
+
+	var hashPolicy []*routev3.RouteAction_HashPolicy
+	if spec.LbPolicy == egressv1.LbPolicyRingHash {
+		hashPolicy = []*routev3.RouteAction_HashPolicy{{
+			PolicySpecifier: &routev3.RouteAction_HashPolicy_ConnectionProperties_{
+				ConnectionProperties: &routev3.RouteAction_HashPolicy_ConnectionProperties{SourceIp: true},
+			},
+		}}
+	}
+
+	var routes []*routev3.Route
+	for _, prefix := range prefixes {
+		routes = append(routes, &routev3.Route{
+			Match: &routev3.RouteMatch{
+				PathSpecifier: &routev3.RouteMatch_Prefix{Prefix: prefix},
+				Headers:       methods,
+			},
+			Action: &routev3.Route_Route{
+				Route: &routev3.RouteAction{
+					ClusterSpecifier: &routev3.RouteAction_Cluster{Cluster: cluster},
+					HashPolicy:       hashPolicy,
+				},
+			},
+		})
+	}
+	routes = append(routes, forbidden)
+
+	var httpFilters []*hcmv3.HttpFilter
+	if port.RateLimit != nil && port.RateLimit.Requests != nil {
+		rateLimitFilter, err := generateHttpRateLimitFilter(port.RateLimit.Requests)
+		if err != nil {
+			return nil, err
+		}
+		httpFilters = append(httpFilters, rateLimitFilter)
+	}
+
+	hcm := &hcmv3.HttpConnectionManager{
+		CodecType:  hcmv3.HttpConnectionManager_AUTO,
+		StatPrefix: "http",
+		AccessLog:  accessLog,
+		// Clients may send Host: name:port, which should still match our names
+		StripPortMode:             &hcmv3.HttpConnectionManager_StripAnyHostPort{StripAnyHostPort: true},
+		CommonHttpProtocolOptions: commonHttpProtocolOptions(spec.ConnectionFor(port)),
+		Tracing:                   tracing,
+		RouteSpecifier: &hcmv3.HttpConnectionManager_RouteConfig{
+			RouteConfig: &routev3.RouteConfiguration{
+				Name: "external_service",
+				VirtualHosts: []*routev3.VirtualHost{
+					{
+						Name:    "external_service",
+						Domains: spec.DnsNames(),
+						Routes:  routes,
+					},
+					{
+						Name:    "forbidden",
+						Domains: []string{"*"},
+						Routes:  []*routev3.Route{forbidden},
+					},
+				},
+			},
+		},
+		HttpFilters: append(httpFilters, &hcmv3.HttpFilter{
+			Name: "envoy.filters.http.router",
+			ConfigType: &hcmv3.HttpFilter_TypedConfig{
+				TypedConfig: routerConfig,
+			},
+		}),
+	}
+	// Paths are normalized before they're matched against allowedPathPrefixes, so /v1/../admin, //admin or
+	// %2Fadmin can't get past them. Escaped slashes are rejected, as the external service may decode them.
+	if port.HTTP != nil && len(port.HTTP.AllowedPathPrefixes) > 0 {
+		hcm.NormalizePath = wrapperspb.Bool(true)
+		hcm.MergeSlashes = true
+		hcm.PathWithEscapedSlashesAction = hcmv3.HttpConnectionManager_REJECT_REQUEST
+	}
+	filterConfig, err := anypb.New(hcm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoylistener.Filter{
+		Name: "envoy.filters.network.http_connection_manager",
+		ConfigType: &envoylistener.Filter_TypedConfig{
+			TypedConfig: filterConfig,
+		},
+	}, nil
+}
+
+// dnsCacheConfig configures the DNS cache shared by the SNI dynamic forward proxy filter and cluster
+// for wildcard ExternalServices. Every user of a cache name must configure it identically.
+func dnsCacheConfig(spec egressv1.ExternalServiceSpec) *dfpcommonv3.DnsCacheConfig {
+	var dnsRefreshRate *duration.Duration
+	if spec.EnvoyDnsRefreshRateS != 0 {
+		dnsRefreshRate = &durationpb.Duration{Seconds: spec.EnvoyDnsRefreshRateS}
+	}
+
+	return &dfpcommonv3.DnsCacheConfig{
+		Name:            "dynamic_forward_proxy_cache",
+		DnsLookupFamily: dnsLookupFamily(spec),
+		DnsRefreshRate:  dnsRefreshRate,
+	}
+}
+
+func generateDynamicForwardProxyCluster(name string, spec egressv1.ExternalServiceSpec, port egressv1.ExternalServicePort) (*envoyv3.Cluster, error) {
+	conn := spec.ConnectionFor(port)
+	clusterConfig, err := anypb.New(&dfpclusterv3.ClusterConfig{
+		ClusterImplementationSpecifier: &dfpclusterv3.ClusterConfig_DnsCacheConfig{
+			DnsCacheConfig: dnsCacheConfig(spec),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoyv3.Cluster{
+		Name: name,
+		ClusterDiscoveryType: &envoyv3.Cluster_ClusterType{
+			ClusterType: &envoyv3.Cluster_CustomClusterType{
+				Name:        "envoy.clusters.dynamic_forward_proxy",
+				TypedConfig: clusterConfig,
+			},
+		},
+		ConnectTimeout:            connectTimeout(conn),
+		LbPolicy:                  envoyv3.Cluster_CLUSTER_PROVIDED,
+		UpstreamConnectionOptions: upstreamConnectionOptions(conn),
+	}, nil
+}
+
+func generateSniDynamicForwardProxyFilter(spec egressv1.ExternalServiceSpec, port egressv1.ExternalServicePort) (*envoylistener.Filter, error) {
+	filterConfig, err := anypb.New(&snidfpv3.FilterConfig{
+		DnsCacheConfig: dnsCacheConfig(spec),
+		PortSpecifier: &snidfpv3.FilterConfig_PortValue{
+			PortValue: uint32(port.Port),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoylistener.Filter{
+		Name: "envoy.filters.network.sni_dynamic_forward_proxy",
+		ConfigType: &envoylistener.Filter_TypedConfig{
+			TypedConfig: filterConfig,
+		},
+	}, nil
+}
+
+func generateTlsInspector() (*envoylistener.ListenerFilter, error) {
+	filterConfig, err := anypb.New(&tlsinspectorv3.TlsInspector{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoylistener.ListenerFilter{
+		Name: "envoy.filters.listener.tls_inspector",
+		ConfigType: &envoylistener.ListenerFilter_TypedConfig{
+			TypedConfig: filterConfig,
+		},
+	}, nil
+}
+
 func generateAggregateCluster(name string, clusters ...string) (*envoyv3.Cluster, error) {
 	aggregateClusterConfig, err := ptypes.MarshalAny(&aggregatev3.ClusterConfig{
 		Clusters: clusters,
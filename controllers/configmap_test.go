@@ -4,6 +4,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"testing"
 
+	hcmv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -13,6 +14,8 @@ import (
 func Test_envoyConfig(t *testing.T) {
 	udp := corev1.ProtocolUDP
 	tcp := corev1.ProtocolTCP
+	samplePercent := int32(10)
+	disableAdminLogs := true
 	var maxConnections uint32
 	maxConnections = 4096
 	type args struct {
@@ -39,7 +42,7 @@ func Test_envoyConfig(t *testing.T) {
             [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
   address:
     socketAddress:
-      address: 0.0.0.0
+      address: 127.0.0.1
       portValue: 11000
 node:
   cluster: foo
@@ -82,6 +85,18 @@ staticResources:
         keepaliveInterval: 5
         keepaliveProbes: 3
         keepaliveTime: 30
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
   listeners:
   - address:
       socketAddress:
@@ -128,6 +143,36 @@ staticResources:
           cluster: foo_TCP_101
           statPrefix: tcp_proxy
     name: foo_TCP_101
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
 `,
 			args: args{
 				es: &egressv1.ExternalService{
@@ -186,7 +231,7 @@ staticResources:
         omitEmptyValues: true
   address:
     socketAddress:
-      address: 0.0.0.0
+      address: 127.0.0.1
       portValue: 11000
 node:
   cluster: foo
@@ -235,6 +280,18 @@ staticResources:
         keepaliveInterval: 5
         keepaliveProbes: 3
         keepaliveTime: 30
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
   listeners:
   - address:
       socketAddress:
@@ -319,6 +376,36 @@ staticResources:
           cluster: foo_TCP_101
           statPrefix: tcp_proxy
     name: foo_TCP_101
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
 `,
 			args: args{
 				es: &egressv1.ExternalService{
@@ -345,17 +432,1967 @@ staticResources:
 				maxConns: &maxConnections,
 			},
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tt.args.es.Spec.EnvoyClusterMaxConnections = tt.args.maxConns
-			got, err := envoyConfig(tt.args.es)
-			if err != nil {
-				t.Error(err)
-			}
-			if got != tt.want {
-				t.Errorf("got:\n%v, want:\n%v", got, tt.want)
-				t.Error(cmp.Diff(got, tt.want))
+		{
+			name: "wildcard",
+			want: `admin:
+  accessLog:
+  - name: envoy.stdout_access_log
+    typedConfig:
+      '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+      logFormat:
+        contentType: application/json; charset=UTF-8
+        omitEmptyValues: true
+        textFormatSource:
+          inlineString: |
+            [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+  address:
+    socketAddress:
+      address: 127.0.0.1
+      portValue: 11000
+node:
+  cluster: foo
+staticResources:
+  clusters:
+  - clusterType:
+      name: envoy.clusters.dynamic_forward_proxy
+      typedConfig:
+        '@type': type.googleapis.com/envoy.extensions.clusters.dynamic_forward_proxy.v3.ClusterConfig
+        dnsCacheConfig:
+          dnsLookupFamily: V4_ONLY
+          name: dynamic_forward_proxy_cache
+    connectTimeout: 1s
+    lbPolicy: CLUSTER_PROVIDED
+    name: foo_TCP_443
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 3
+        keepaliveTime: 30
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
+  listeners:
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 443
+    filterChains:
+    - filterChainMatch:
+        serverNames:
+        - '*.googleapis.com'
+      filters:
+      - name: envoy.filters.network.sni_dynamic_forward_proxy
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.sni_dynamic_forward_proxy.v3.FilterConfig
+          dnsCacheConfig:
+            dnsLookupFamily: V4_ONLY
+            name: dynamic_forward_proxy_cache
+          portValue: 443
+      - name: envoy.tcp_proxy
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+          accessLog:
+          - name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    [%START_TIME%] %BYTES_RECEIVED% %BYTES_SENT% %DURATION% "%DOWNSTREAM_REMOTE_ADDRESS%" "%UPSTREAM_HOST%" "%UPSTREAM_CLUSTER%" "%REQUESTED_SERVER_NAME%"
+          cluster: foo_TCP_443
+          statPrefix: tcp_proxy
+    listenerFilters:
+    - name: envoy.filters.listener.tls_inspector
+      typedConfig:
+        '@type': type.googleapis.com/envoy.extensions.filters.listener.tls_inspector.v3.TlsInspector
+    name: foo_TCP_443
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
+`,
+			args: args{
+				es: &egressv1.ExternalService{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "foo",
+					},
+					Spec: egressv1.ExternalServiceSpec{
+						DnsName: "*.googleapis.com",
+						Ports: []egressv1.ExternalServicePort{
+							{
+								Port:     443,
+								Protocol: &tcp,
+							},
+						},
+					},
+				},
+				maxConns: nil,
+			},
+		},
+		{
+			name: "allowed server names",
+			want: `admin:
+  accessLog:
+  - name: envoy.stdout_access_log
+    typedConfig:
+      '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+      logFormat:
+        contentType: application/json; charset=UTF-8
+        omitEmptyValues: true
+        textFormatSource:
+          inlineString: |
+            [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+  address:
+    socketAddress:
+      address: 127.0.0.1
+      portValue: 11000
+node:
+  cluster: foo
+staticResources:
+  clusters:
+  - connectTimeout: 1s
+    dnsLookupFamily: V4_ONLY
+    loadAssignment:
+      clusterName: foo_TCP_443
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: google.com
+                portValue: 443
+    name: foo_TCP_443
+    type: LOGICAL_DNS
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 3
+        keepaliveTime: 30
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
+  listeners:
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 443
+    filterChains:
+    - filterChainMatch:
+        serverNames:
+        - google.com
+        - '*.google.com'
+      filters:
+      - name: envoy.tcp_proxy
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+          accessLog:
+          - name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    [%START_TIME%] %BYTES_RECEIVED% %BYTES_SENT% %DURATION% "%DOWNSTREAM_REMOTE_ADDRESS%" "%UPSTREAM_HOST%" "%UPSTREAM_CLUSTER%" "%REQUESTED_SERVER_NAME%"
+          cluster: foo_TCP_443
+          statPrefix: tcp_proxy
+    listenerFilters:
+    - name: envoy.filters.listener.tls_inspector
+      typedConfig:
+        '@type': type.googleapis.com/envoy.extensions.filters.listener.tls_inspector.v3.TlsInspector
+    name: foo_TCP_443
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
+`,
+			args: args{
+				es: &egressv1.ExternalService{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "foo",
+					},
+					Spec: egressv1.ExternalServiceSpec{
+						DnsName: "google.com",
+						Ports: []egressv1.ExternalServicePort{
+							{
+								Port:               443,
+								Protocol:           &tcp,
+								AllowedServerNames: []string{"google.com", "*.google.com"},
+							},
+						},
+					},
+				},
+				maxConns: nil,
+			},
+		},
+		{
+			name: "http mode",
+			want: `admin:
+  accessLog:
+  - name: envoy.stdout_access_log
+    typedConfig:
+      '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+      logFormat:
+        contentType: application/json; charset=UTF-8
+        omitEmptyValues: true
+        textFormatSource:
+          inlineString: |
+            [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+  address:
+    socketAddress:
+      address: 127.0.0.1
+      portValue: 11000
+node:
+  cluster: foo
+staticResources:
+  clusters:
+  - connectTimeout: 1s
+    dnsLookupFamily: V4_ONLY
+    loadAssignment:
+      clusterName: foo_TCP_80
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: example.com
+                portValue: 80
+    name: foo_TCP_80
+    type: LOGICAL_DNS
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 3
+        keepaliveTime: 30
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
+  listeners:
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 80
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          accessLog:
+          - name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%DOWNSTREAM_REMOTE_ADDRESS%" "%REQ(USER-AGENT)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%" "%UPSTREAM_CLUSTER%"
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          mergeSlashes: true
+          normalizePath: true
+          pathWithEscapedSlashesAction: REJECT_REQUEST
+          routeConfig:
+            name: external_service
+            virtualHosts:
+            - domains:
+              - example.com
+              name: external_service
+              routes:
+              - match:
+                  headers:
+                  - name: :method
+                    stringMatch:
+                      safeRegex:
+                        regex: GET|HEAD
+                  prefix: /v1/
+                route:
+                  cluster: foo_TCP_80
+              - match:
+                  headers:
+                  - name: :method
+                    stringMatch:
+                      safeRegex:
+                        regex: GET|HEAD
+                  prefix: /healthz
+                route:
+                  cluster: foo_TCP_80
+              - directResponse:
+                  status: 403
+                match:
+                  prefix: /
+            - domains:
+              - '*'
+              name: forbidden
+              routes:
+              - directResponse:
+                  status: 403
+                match:
+                  prefix: /
+          statPrefix: http
+          stripAnyHostPort: true
+    name: foo_TCP_80
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
+`,
+			args: args{
+				es: &egressv1.ExternalService{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "foo",
+					},
+					Spec: egressv1.ExternalServiceSpec{
+						DnsName: "example.com",
+						Ports: []egressv1.ExternalServicePort{
+							{
+								Port:     80,
+								Protocol: &tcp,
+								Mode:     egressv1.PortModeHTTP,
+								HTTP: &egressv1.HTTPPortOptions{
+									AllowedMethods:      []string{"GET", "HEAD"},
+									AllowedPathPrefixes: []string{"/v1/", "/healthz"},
+								},
+							},
+						},
+					},
+				},
+				maxConns: nil,
+			},
+		},
+		{
+			name: "tls origination",
+			want: `admin:
+  accessLog:
+  - name: envoy.stdout_access_log
+    typedConfig:
+      '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+      logFormat:
+        contentType: application/json; charset=UTF-8
+        omitEmptyValues: true
+        textFormatSource:
+          inlineString: |
+            [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+  address:
+    socketAddress:
+      address: 127.0.0.1
+      portValue: 11000
+node:
+  cluster: foo
+staticResources:
+  clusters:
+  - connectTimeout: 1s
+    dnsLookupFamily: V4_ONLY
+    loadAssignment:
+      clusterName: foo_TCP_80
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: example.com
+                portValue: 443
+    name: foo_TCP_80
+    transportSocket:
+      name: envoy.transport_sockets.tls
+      typedConfig:
+        '@type': type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext
+        commonTlsContext:
+          tlsCertificates:
+          - certificateChain:
+              filename: /etc/egress-tls/example-client/tls.crt
+            privateKey:
+              filename: /etc/egress-tls/example-client/tls.key
+          validationContext:
+            matchTypedSubjectAltNames:
+            - matcher:
+                exact: example.com
+              sanType: DNS
+            trustedCa:
+              filename: /etc/egress-tls/example-ca/ca.crt
+        sni: example.com
+    type: LOGICAL_DNS
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 3
+        keepaliveTime: 30
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
+  listeners:
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 80
+    filterChains:
+    - filters:
+      - name: envoy.tcp_proxy
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+          accessLog:
+          - name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    [%START_TIME%] %BYTES_RECEIVED% %BYTES_SENT% %DURATION% "%DOWNSTREAM_REMOTE_ADDRESS%" "%UPSTREAM_HOST%" "%UPSTREAM_CLUSTER%"
+          cluster: foo_TCP_80
+          statPrefix: tcp_proxy
+    name: foo_TCP_80
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
+`,
+			args: args{
+				es: &egressv1.ExternalService{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "foo",
+					},
+					Spec: egressv1.ExternalServiceSpec{
+						DnsName: "example.com",
+						Ports: []egressv1.ExternalServicePort{
+							{
+								Port:     80,
+								Protocol: &tcp,
+								TLS: &egressv1.TLSOrigination{
+									TargetPort:                  443,
+									CASecretName:                "example-ca",
+									ClientCertificateSecretName: "example-client",
+								},
+							},
+						},
+					},
+				},
+				maxConns: nil,
+			},
+		},
+		{
+			name: "health check and outlier detection",
+			want: `admin:
+  accessLog:
+  - name: envoy.stdout_access_log
+    typedConfig:
+      '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+      logFormat:
+        contentType: application/json; charset=UTF-8
+        omitEmptyValues: true
+        textFormatSource:
+          inlineString: |
+            [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+  address:
+    socketAddress:
+      address: 127.0.0.1
+      portValue: 11000
+node:
+  cluster: foo
+staticResources:
+  clusters:
+  - connectTimeout: 1s
+    dnsLookupFamily: V4_ONLY
+    healthChecks:
+    - eventLogPath: /dev/stdout
+      healthyThreshold: 3
+      httpHealthCheck:
+        expectedStatuses:
+        - end: "201"
+          start: "200"
+        - end: "205"
+          start: "204"
+        host: example.com
+        path: /health
+      interval: 5s
+      reuseConnection: false
+      timeout: 1s
+      unhealthyThreshold: 2
+    loadAssignment:
+      clusterName: foo_TCP_443
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: example.com
+                portValue: 443
+    name: foo_TCP_443
+    outlierDetection:
+      baseEjectionTime: 60s
+      consecutive5xx: 3
+    type: LOGICAL_DNS
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 3
+        keepaliveTime: 30
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
+  listeners:
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 443
+    filterChains:
+    - filters:
+      - name: envoy.tcp_proxy
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+          accessLog:
+          - name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    [%START_TIME%] %BYTES_RECEIVED% %BYTES_SENT% %DURATION% "%DOWNSTREAM_REMOTE_ADDRESS%" "%UPSTREAM_HOST%" "%UPSTREAM_CLUSTER%"
+          cluster: foo_TCP_443
+          statPrefix: tcp_proxy
+    name: foo_TCP_443
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
+`,
+			args: args{
+				es: &egressv1.ExternalService{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "foo",
+					},
+					Spec: egressv1.ExternalServiceSpec{
+						DnsName: "example.com",
+						Ports: []egressv1.ExternalServicePort{
+							{
+								Port:     443,
+								Protocol: &tcp,
+							},
+						},
+						HealthCheck: &egressv1.HealthCheck{
+							Type:             egressv1.HealthCheckHTTP,
+							Path:             "/health",
+							ExpectedStatuses: []int32{200, 204},
+							IntervalSeconds:  5,
+						},
+						OutlierDetection: &egressv1.OutlierDetection{
+							ConsecutiveFailures:     3,
+							BaseEjectionTimeSeconds: 60,
+						},
+					},
+				},
+				maxConns: nil,
+			},
+		},
+		{
+			name: "strict dns with ring hash",
+			want: `admin:
+  accessLog:
+  - name: envoy.stdout_access_log
+    typedConfig:
+      '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+      logFormat:
+        contentType: application/json; charset=UTF-8
+        omitEmptyValues: true
+        textFormatSource:
+          inlineString: |
+            [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+  address:
+    socketAddress:
+      address: 127.0.0.1
+      portValue: 11000
+node:
+  cluster: foo
+staticResources:
+  clusters:
+  - connectTimeout: 1s
+    dnsLookupFamily: V4_ONLY
+    lbPolicy: RING_HASH
+    loadAssignment:
+      clusterName: foo_TCP_443
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: example.com
+                portValue: 443
+    name: foo_TCP_443
+    type: STRICT_DNS
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 3
+        keepaliveTime: 30
+  - connectTimeout: 1s
+    dnsLookupFamily: V4_ONLY
+    lbPolicy: RING_HASH
+    loadAssignment:
+      clusterName: foo_UDP_53
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: example.com
+                portValue: 53
+                protocol: UDP
+    name: foo_UDP_53
+    type: STRICT_DNS
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 3
+        keepaliveTime: 30
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
+  listeners:
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 443
+    filterChains:
+    - filters:
+      - name: envoy.tcp_proxy
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+          accessLog:
+          - name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    [%START_TIME%] %BYTES_RECEIVED% %BYTES_SENT% %DURATION% "%DOWNSTREAM_REMOTE_ADDRESS%" "%UPSTREAM_HOST%" "%UPSTREAM_CLUSTER%"
+          cluster: foo_TCP_443
+          hashPolicy:
+          - sourceIp: {}
+          statPrefix: tcp_proxy
+    name: foo_TCP_443
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 53
+        protocol: UDP
+    filterChains:
+    - filters:
+      - name: envoy.filters.udp_listener.udp_proxy
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.UdpProxyConfig
+          accessLog:
+          - name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    [%START_TIME%] %BYTES_RECEIVED% %BYTES_SENT% %DURATION% "%DOWNSTREAM_REMOTE_ADDRESS%" "%UPSTREAM_HOST%" "%UPSTREAM_CLUSTER%"
+          cluster: foo_UDP_53
+          hashPolicies:
+          - sourceIp: true
+          statPrefix: udp_proxy
+    name: foo_UDP_53
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
+`,
+			args: args{
+				es: &egressv1.ExternalService{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "foo",
+					},
+					Spec: egressv1.ExternalServiceSpec{
+						DnsName: "example.com",
+						Ports: []egressv1.ExternalServicePort{
+							{
+								Port:     443,
+								Protocol: &tcp,
+							},
+							{
+								Port:     53,
+								Protocol: &udp,
+							},
+						},
+						DiscoveryType: egressv1.DiscoveryTypeStrictDNS,
+						LbPolicy:      egressv1.LbPolicyRingHash,
+					},
+				},
+				maxConns: nil,
+			},
+		},
+		{
+			name: "dual stack",
+			want: `admin:
+  accessLog:
+  - name: envoy.stdout_access_log
+    typedConfig:
+      '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+      logFormat:
+        contentType: application/json; charset=UTF-8
+        omitEmptyValues: true
+        textFormatSource:
+          inlineString: |
+            [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+  address:
+    socketAddress:
+      address: 127.0.0.1
+      portValue: 11000
+node:
+  cluster: foo
+staticResources:
+  clusters:
+  - clusterType:
+      name: envoy.clusters.aggregate
+      typedConfig:
+        '@type': type.googleapis.com/envoy.extensions.clusters.aggregate.v3.ClusterConfig
+        clusters:
+        - foo_TCP_443-override
+        - foo_TCP_443
+    connectTimeout: 1s
+    lbPolicy: CLUSTER_PROVIDED
+    name: foo_TCP_443-aggregate
+  - closeConnectionsOnHostHealthFailure: true
+    connectTimeout: 1s
+    dnsLookupFamily: V4_PREFERRED
+    healthChecks:
+    - eventLogPath: /dev/stdout
+      healthyThreshold: 3
+      interval: 10s
+      reuseConnection: false
+      tcpHealthCheck: {}
+      timeout: 1s
+      unhealthyThreshold: 2
+    loadAssignment:
+      clusterName: foo_TCP_443-override
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 2001:db8::1
+                portValue: 443
+            healthCheckConfig:
+              portValue: 443
+    name: foo_TCP_443-override
+    type: STATIC
+  - connectTimeout: 1s
+    dnsLookupFamily: V4_PREFERRED
+    loadAssignment:
+      clusterName: foo_TCP_443
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: example.com
+                portValue: 443
+    name: foo_TCP_443
+    type: LOGICAL_DNS
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 3
+        keepaliveTime: 30
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
+  listeners:
+  - address:
+      socketAddress:
+        address: '::'
+        ipv4Compat: true
+        portValue: 443
+    filterChains:
+    - filters:
+      - name: envoy.tcp_proxy
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+          accessLog:
+          - name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    [%START_TIME%] %BYTES_RECEIVED% %BYTES_SENT% %DURATION% "%DOWNSTREAM_REMOTE_ADDRESS%" "%UPSTREAM_HOST%" "%UPSTREAM_CLUSTER%"
+          cluster: foo_TCP_443-aggregate
+          statPrefix: tcp_proxy
+    name: foo_TCP_443
+  - address:
+      socketAddress:
+        address: '::'
+        ipv4Compat: true
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
+`,
+			args: args{
+				es: &egressv1.ExternalService{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "foo",
+					},
+					Spec: egressv1.ExternalServiceSpec{
+						DnsName: "example.com",
+						Ports: []egressv1.ExternalServicePort{
+							{
+								Port:     443,
+								Protocol: &tcp,
+							},
+						},
+						IpFamily:   egressv1.IpFamilyDualStackPreferIPv4,
+						IpOverride: []string{"2001:db8::1"},
+					},
+				},
+				maxConns: nil,
+			},
+		},
+		{
+			name: "connection settings",
+			want: `admin:
+  accessLog:
+  - name: envoy.stdout_access_log
+    typedConfig:
+      '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+      logFormat:
+        contentType: application/json; charset=UTF-8
+        omitEmptyValues: true
+        textFormatSource:
+          inlineString: |
+            [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+  address:
+    socketAddress:
+      address: 127.0.0.1
+      portValue: 11000
+node:
+  cluster: foo
+staticResources:
+  clusters:
+  - connectTimeout: 5s
+    dnsLookupFamily: V4_ONLY
+    loadAssignment:
+      clusterName: foo_TCP_5432
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: example.com
+                portValue: 5432
+    name: foo_TCP_5432
+    type: LOGICAL_DNS
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 5
+        keepaliveTime: 300
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
+  listeners:
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 5432
+    filterChains:
+    - filters:
+      - name: envoy.tcp_proxy
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+          accessLog:
+          - name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    [%START_TIME%] %BYTES_RECEIVED% %BYTES_SENT% %DURATION% "%DOWNSTREAM_REMOTE_ADDRESS%" "%UPSTREAM_HOST%" "%UPSTREAM_CLUSTER%"
+          cluster: foo_TCP_5432
+          idleTimeout: 86400s
+          maxConnectAttempts: 3
+          statPrefix: tcp_proxy
+    name: foo_TCP_5432
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
+`,
+			args: args{
+				es: &egressv1.ExternalService{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "foo",
+					},
+					Spec: egressv1.ExternalServiceSpec{
+						DnsName: "example.com",
+						Ports: []egressv1.ExternalServicePort{
+							{
+								Port:     5432,
+								Protocol: &tcp,
+								Connection: &egressv1.ConnectionSettings{
+									IdleTimeoutSeconds: 86400,
+									MaxConnectAttempts: 3,
+									TcpKeepalive:       &egressv1.TcpKeepalive{TimeSeconds: 300},
+								},
+							},
+						},
+						Connection: &egressv1.ConnectionSettings{
+							ConnectTimeoutSeconds: 5,
+							TcpKeepalive:          &egressv1.TcpKeepalive{Probes: 5},
+						},
+					},
+				},
+				maxConns: nil,
+			},
+		},
+		{
+			name: "circuit breakers and connection limit",
+			want: `admin:
+  accessLog:
+  - name: envoy.stdout_access_log
+    typedConfig:
+      '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+      logFormat:
+        contentType: application/json; charset=UTF-8
+        omitEmptyValues: true
+        textFormatSource:
+          inlineString: |
+            [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+  address:
+    socketAddress:
+      address: 127.0.0.1
+      portValue: 11000
+node:
+  cluster: foo
+staticResources:
+  clusters:
+  - circuitBreakers:
+      perHostThresholds:
+      - maxConnections: 256
+      thresholds:
+      - maxConnections: 2048
+        retryBudget:
+          budgetPercent:
+            value: 25
+          minRetryConcurrency: 5
+    connectTimeout: 1s
+    dnsLookupFamily: V4_ONLY
+    loadAssignment:
+      clusterName: foo_TCP_443
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: example.com
+                portValue: 443
+    name: foo_TCP_443
+    type: LOGICAL_DNS
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 3
+        keepaliveTime: 30
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
+  listeners:
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 443
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.connection_limit
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.connection_limit.v3.ConnectionLimit
+          maxConnections: "500"
+          statPrefix: connection_limit
+      - name: envoy.tcp_proxy
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+          accessLog:
+          - name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    [%START_TIME%] %BYTES_RECEIVED% %BYTES_SENT% %DURATION% "%DOWNSTREAM_REMOTE_ADDRESS%" "%UPSTREAM_HOST%" "%UPSTREAM_CLUSTER%"
+          cluster: foo_TCP_443
+          statPrefix: tcp_proxy
+    name: foo_TCP_443
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
+`,
+			args: args{
+				es: &egressv1.ExternalService{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "foo",
+					},
+					Spec: egressv1.ExternalServiceSpec{
+						DnsName: "example.com",
+						Ports: []egressv1.ExternalServicePort{
+							{
+								Port:     443,
+								Protocol: &tcp,
+							},
+						},
+						Connection: &egressv1.ConnectionSettings{MaxClientConnections: 500},
+						CircuitBreakers: &egressv1.CircuitBreakers{
+							MaxConnections:        2048,
+							PerHostMaxConnections: 256,
+							RetryBudget:           &egressv1.RetryBudget{BudgetPercent: 25, MinRetryConcurrency: 5},
+						},
+					},
+				},
+				maxConns: nil,
+			},
+		},
+		{
+			name: "rate limits",
+			want: `admin:
+  accessLog:
+  - name: envoy.stdout_access_log
+    typedConfig:
+      '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+      logFormat:
+        contentType: application/json; charset=UTF-8
+        omitEmptyValues: true
+        textFormatSource:
+          inlineString: |
+            [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+  address:
+    socketAddress:
+      address: 127.0.0.1
+      portValue: 11000
+node:
+  cluster: foo
+staticResources:
+  clusters:
+  - connectTimeout: 1s
+    dnsLookupFamily: V4_ONLY
+    loadAssignment:
+      clusterName: foo_TCP_443
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: example.com
+                portValue: 443
+    name: foo_TCP_443
+    type: LOGICAL_DNS
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 3
+        keepaliveTime: 30
+  - connectTimeout: 1s
+    dnsLookupFamily: V4_ONLY
+    loadAssignment:
+      clusterName: foo_TCP_80
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: example.com
+                portValue: 80
+    name: foo_TCP_80
+    type: LOGICAL_DNS
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 3
+        keepaliveTime: 30
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
+  listeners:
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 443
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.local_ratelimit
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.local_ratelimit.v3.LocalRateLimit
+          statPrefix: local_rate_limit
+          tokenBucket:
+            fillInterval: 1s
+            maxTokens: 100
+            tokensPerFill: 10
+      - name: envoy.tcp_proxy
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+          accessLog:
+          - name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    [%START_TIME%] %BYTES_RECEIVED% %BYTES_SENT% %DURATION% "%DOWNSTREAM_REMOTE_ADDRESS%" "%UPSTREAM_HOST%" "%UPSTREAM_CLUSTER%"
+          cluster: foo_TCP_443
+          statPrefix: tcp_proxy
+    name: foo_TCP_443
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 80
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          accessLog:
+          - name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%DOWNSTREAM_REMOTE_ADDRESS%" "%REQ(USER-AGENT)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%" "%UPSTREAM_CLUSTER%"
+          httpFilters:
+          - name: envoy.filters.http.local_ratelimit
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit
+              filterEnabled:
+                defaultValue:
+                  numerator: 100
+                runtimeKey: local_rate_limit_enabled
+              filterEnforced:
+                defaultValue:
+                  numerator: 100
+                runtimeKey: local_rate_limit_enforced
+              statPrefix: http_local_rate_limit
+              tokenBucket:
+                fillInterval: 60s
+                maxTokens: 50
+                tokensPerFill: 1
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: external_service
+            virtualHosts:
+            - domains:
+              - example.com
+              name: external_service
+              routes:
+              - match:
+                  prefix: /
+                route:
+                  cluster: foo_TCP_80
+              - directResponse:
+                  status: 403
+                match:
+                  prefix: /
+            - domains:
+              - '*'
+              name: forbidden
+              routes:
+              - directResponse:
+                  status: 403
+                match:
+                  prefix: /
+          statPrefix: http
+          stripAnyHostPort: true
+    name: foo_TCP_80
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
+`,
+			args: args{
+				es: &egressv1.ExternalService{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "foo",
+					},
+					Spec: egressv1.ExternalServiceSpec{
+						DnsName: "example.com",
+						Ports: []egressv1.ExternalServicePort{
+							{
+								Port:      443,
+								Protocol:  &tcp,
+								RateLimit: &egressv1.RateLimit{Connections: &egressv1.TokenBucket{MaxTokens: 100, TokensPerFill: 10}},
+							},
+							{
+								Port:      80,
+								Protocol:  &tcp,
+								Mode:      egressv1.PortModeHTTP,
+								RateLimit: &egressv1.RateLimit{Requests: &egressv1.TokenBucket{MaxTokens: 50, FillIntervalSeconds: 60}},
+							},
+						},
+					},
+				},
+				maxConns: nil,
+			},
+		},
+		{
+			name: "access log sinks",
+			want: `admin:
+  accessLog:
+  - name: envoy.stdout_access_log
+    typedConfig:
+      '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+      logFormat:
+        contentType: application/json; charset=UTF-8
+        omitEmptyValues: true
+        textFormatSource:
+          inlineString: |
+            [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+  address:
+    socketAddress:
+      address: 127.0.0.1
+      portValue: 11000
+node:
+  cluster: foo
+staticResources:
+  clusters:
+  - connectTimeout: 1s
+    dnsLookupFamily: V4_ONLY
+    loadAssignment:
+      clusterName: foo_TCP_443
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: example.com
+                portValue: 443
+    name: foo_TCP_443
+    type: LOGICAL_DNS
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 3
+        keepaliveTime: 30
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: access_log_10_96_0_50_9001
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 10.96.0.50
+                portValue: 9001
+    name: access_log_10_96_0_50_9001
+    type: STATIC
+    typedExtensionProtocolOptions:
+      envoy.extensions.upstreams.http.v3.HttpProtocolOptions:
+        '@type': type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions
+        explicitHttpConfig:
+          http2ProtocolOptions: {}
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: access_log_otel_collector_example_internal_4317
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: otel-collector.example.internal
+                portValue: 4317
+    name: access_log_otel_collector_example_internal_4317
+    type: STRICT_DNS
+    typedExtensionProtocolOptions:
+      envoy.extensions.upstreams.http.v3.HttpProtocolOptions:
+        '@type': type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions
+        explicitHttpConfig:
+          http2ProtocolOptions: {}
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
+  listeners:
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 443
+    filterChains:
+    - filters:
+      - name: envoy.tcp_proxy
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+          accessLog:
+          - name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    %DOWNSTREAM_REMOTE_ADDRESS% %UPSTREAM_HOST%
+          - name: envoy.access_loggers.file
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.file.v3.FileAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    %DOWNSTREAM_REMOTE_ADDRESS% %UPSTREAM_HOST%
+              path: /dev/stderr
+          - name: envoy.access_loggers.tcp_grpc
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.grpc.v3.TcpGrpcAccessLogConfig
+              commonConfig:
+                grpcService:
+                  envoyGrpc:
+                    clusterName: access_log_10_96_0_50_9001
+                logName: foo
+                transportApiVersion: V3
+          - name: envoy.access_loggers.open_telemetry
+            typedConfig:
+              '@type': type.googleapis.com/xds.type.v3.TypedStruct
+              typeUrl: type.googleapis.com/envoy.extensions.access_loggers.open_telemetry.v3.OpenTelemetryAccessLogConfig
+              value:
+                body:
+                  string_value: '%DOWNSTREAM_REMOTE_ADDRESS% %UPSTREAM_HOST%'
+                common_config:
+                  grpc_service:
+                    envoy_grpc:
+                      cluster_name: access_log_otel_collector_example_internal_4317
+                  log_name: egress
+                  transport_api_version: V3
+          cluster: foo_TCP_443
+          statPrefix: tcp_proxy
+    name: foo_TCP_443
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
+`,
+			args: args{
+				es: &egressv1.ExternalService{
+					ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"},
+					Spec: egressv1.ExternalServiceSpec{
+						DnsName: "example.com",
+						Ports:   []egressv1.ExternalServicePort{{Port: 443, Protocol: &tcp}},
+						AccessLog: &egressv1.AccessLog{
+							TextFormat: "%DOWNSTREAM_REMOTE_ADDRESS% %UPSTREAM_HOST%",
+							Sinks: []egressv1.AccessLogSink{
+								{Type: egressv1.AccessLogSinkFile, Path: "/dev/stderr"},
+								{Type: egressv1.AccessLogSinkGRPC, Address: "10.96.0.50:9001"},
+								{Type: egressv1.AccessLogSinkOpenTelemetry, Address: "otel-collector.example.internal:4317", LogName: "egress"},
+							},
+						},
+					},
+				},
+				maxConns: nil,
+			},
+		},
+		{
+			name: "access log filter",
+			want: `admin:
+  address:
+    socketAddress:
+      address: 127.0.0.1
+      portValue: 11000
+node:
+  cluster: foo
+staticResources:
+  clusters:
+  - connectTimeout: 1s
+    dnsLookupFamily: V4_ONLY
+    loadAssignment:
+      clusterName: foo_TCP_443
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: example.com
+                portValue: 443
+    name: foo_TCP_443
+    type: LOGICAL_DNS
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 3
+        keepaliveTime: 30
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
+  listeners:
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 443
+    filterChains:
+    - filters:
+      - name: envoy.tcp_proxy
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+          accessLog:
+          - filter:
+              andFilter:
+                filters:
+                - runtimeFilter:
+                    percentSampled:
+                      numerator: 10
+                    runtimeKey: access_log.sample_percent
+                - responseFlagFilter: {}
+                - durationFilter:
+                    comparison:
+                      op: GE
+                      value:
+                        defaultValue: 500
+                        runtimeKey: access_log.min_duration_ms
+            name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    [%START_TIME%] %BYTES_RECEIVED% %BYTES_SENT% %DURATION% "%DOWNSTREAM_REMOTE_ADDRESS%" "%UPSTREAM_HOST%" "%UPSTREAM_CLUSTER%"
+          cluster: foo_TCP_443
+          statPrefix: tcp_proxy
+    name: foo_TCP_443
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
+`,
+			args: args{
+				es: &egressv1.ExternalService{
+					ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"},
+					Spec: egressv1.ExternalServiceSpec{
+						DnsName: "example.com",
+						Ports:   []egressv1.ExternalServicePort{{Port: 443, Protocol: &tcp}},
+						AccessLog: &egressv1.AccessLog{
+							Filter:           &egressv1.AccessLogFilter{SamplePercent: &samplePercent, OnlyErrors: true, MinDurationMilliseconds: 500},
+							DisableAdminLogs: &disableAdminLogs,
+						},
+					},
+				},
+				maxConns: nil,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.args.es.Spec.EnvoyClusterMaxConnections = tt.args.maxConns
+			got, err := envoyConfig(tt.args.es)
+			if err != nil {
+				t.Error(err)
+			}
+			if got != tt.want {
+				t.Errorf("got:\n%v, want:\n%v", got, tt.want)
+				t.Error(cmp.Diff(got, tt.want))
+			}
+		})
+	}
+}
+
+func Test_generateHealthCheck(t *testing.T) {
+	spec := egressv1.ExternalServiceSpec{DnsName: "example.com"}
+
+	hc := generateHealthCheck(spec, &egressv1.HealthCheck{})
+	if hc.Interval.Seconds != 10 || hc.Timeout.Seconds != 1 || hc.UnhealthyThreshold.Value != 2 || hc.HealthyThreshold.Value != 3 {
+		t.Errorf("generateHealthCheck() defaults = %v", hc)
+	}
+	if hc.GetTcpHealthCheck() != nil || hc.GetHttpHealthCheck() != nil || hc.TransportSocketMatchCriteria != nil {
+		t.Errorf("generateHealthCheck() = %v, want a plain TCP health check", hc)
+	}
+
+	hc = generateHealthCheck(spec, &egressv1.HealthCheck{Type: egressv1.HealthCheckTLS})
+	if hc.TransportSocketMatchCriteria != healthCheckTlsMatch {
+		t.Errorf("generateHealthCheck() transport socket match = %v, want %v", hc.TransportSocketMatchCriteria, healthCheckTlsMatch)
+	}
+}
+
+func Test_generateHttpConnectionManager_normalizePath(t *testing.T) {
+	spec := egressv1.ExternalServiceSpec{DnsName: "example.com"}
+
+	for name, tt := range map[string]struct {
+		http          *egressv1.HTTPPortOptions
+		wantNormalize bool
+	}{
+		"all paths":     {http: nil},
+		"path prefixes": {http: &egressv1.HTTPPortOptions{AllowedPathPrefixes: []string{"/v1/"}}, wantNormalize: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			port := egressv1.ExternalServicePort{Port: 80, Mode: egressv1.PortModeHTTP, HTTP: tt.http}
+			filter, err := generateHttpConnectionManager(spec, port, "example", nil, nil)
+			if err != nil {
+				t.Fatalf("generateHttpConnectionManager() error = %v", err)
+			}
+			hcm := &hcmv3.HttpConnectionManager{}
+			if err := filter.GetTypedConfig().UnmarshalTo(hcm); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := hcm.GetNormalizePath().GetValue(); got != tt.wantNormalize {
+				t.Errorf("generateHttpConnectionManager() normalizePath = %v, want %v", got, tt.wantNormalize)
+			}
+			if got := hcm.GetMergeSlashes(); got != tt.wantNormalize {
+				t.Errorf("generateHttpConnectionManager() mergeSlashes = %v, want %v", got, tt.wantNormalize)
+			}
+			wantAction := hcmv3.HttpConnectionManager_IMPLEMENTATION_SPECIFIC_DEFAULT
+			if tt.wantNormalize {
+				wantAction = hcmv3.HttpConnectionManager_REJECT_REQUEST
+			}
+			if got := hcm.GetPathWithEscapedSlashesAction(); got != wantAction {
+				t.Errorf("generateHttpConnectionManager() pathWithEscapedSlashesAction = %v, want %v", got, wantAction)
 			}
 		})
 	}
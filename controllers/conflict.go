@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+// dnsNameField indexes ExternalServices by the lower-cased DNS names they claim
+const dnsNameField = ".spec.dnsName"
+
+func indexDnsNames(o client.Object) []string {
+	es, ok := o.(*egressv1.ExternalService)
+	if !ok {
+		return nil
+	}
+
+	var names []string
+	for _, name := range es.Spec.DnsNames() {
+		if name != "" {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+
+	return names
+}
+
+// dnsNameOwner returns the first of es's DNS names which is owned by another ExternalService, along with
+// that ExternalService's name. If es owns all of its names, it returns DnsName and es's own name. If several
+// ExternalServices claim the same name the oldest wins, with ties broken by name.
+func (r *ExternalServiceReconciler) dnsNameOwner(ctx context.Context, es *egressv1.ExternalService) (string, string, error) {
+	for _, name := range indexDnsNames(es) {
+		list := &egressv1.ExternalServiceList{}
+		if err := r.List(ctx, list, client.MatchingFields{dnsNameField: name}); err != nil {
+			return "", "", err
+		}
+
+		if owner := dnsNameOwner(es, list.Items); owner != es.Name {
+			return name, owner, nil
+		}
+	}
+
+	return es.Spec.DnsName, es.Name, nil
+}
+
+func dnsNameOwner(es *egressv1.ExternalService, claimants []egressv1.ExternalService) string {
+	candidates := []egressv1.ExternalService{*es}
+	for _, c := range claimants {
+		if c.Name == es.Name || c.DeletionTimestamp != nil {
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		ci, cj := candidates[i].CreationTimestamp, candidates[j].CreationTimestamp
+		if !ci.Equal(&cj) {
+			return ci.Before(&cj)
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+
+	return candidates[0].Name
+}
+
+// externalServicesSharingDnsName maps an ExternalService to the other ExternalServices claiming the same
+// DNS name, so that a conflict is re-evaluated when one of them changes or is deleted.
+func (r *ExternalServiceReconciler) externalServicesSharingDnsName(ctx context.Context, o client.Object) []reconcile.Request {
+	var requests []reconcile.Request
+	for _, name := range indexDnsNames(o) {
+		list := &egressv1.ExternalServiceList{}
+		if err := r.List(ctx, list, client.MatchingFields{dnsNameField: name}); err != nil {
+			r.Log.Error(err, "unable to list ExternalServices sharing a DNS name", "dnsName", name)
+			continue
+		}
+
+		for _, es := range list.Items {
+			if es.Name == o.GetName() {
+				continue
+			}
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKey{Name: es.Name}})
+		}
+	}
+
+	return requests
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/monzo/egress-operator/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_dnsNameOwner(t *testing.T) {
+	now := time.Now()
+	es := func(name string, age time.Duration) v1.ExternalService {
+		return v1.ExternalService{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+			},
+			Spec: v1.ExternalServiceSpec{DnsName: "google.com"},
+		}
+	}
+	deleted := es("deleted", time.Hour)
+	deleted.DeletionTimestamp = &metav1.Time{Time: now}
+
+	tests := []struct {
+		name      string
+		es        v1.ExternalService
+		claimants []v1.ExternalService
+		want      string
+	}{
+		{"alone", es("google", 0), []v1.ExternalService{es("google", 0)}, "google"},
+		{"oldest-wins", es("google", 0), []v1.ExternalService{es("google", 0), es("google-old", time.Minute)}, "google-old"},
+		{"newer-loses", es("google", time.Minute), []v1.ExternalService{es("google-new", 0)}, "google"},
+		{"tie-broken-by-name", es("b", time.Minute), []v1.ExternalService{es("a", time.Minute)}, "a"},
+		{"deleted-ignored", es("google", 0), []v1.ExternalService{deleted}, "google"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dnsNameOwner(&tt.es, tt.claimants); got != tt.want {
+				t.Errorf("dnsNameOwner() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_indexDnsNames(t *testing.T) {
+	es := &v1.ExternalService{
+		Spec: v1.ExternalServiceSpec{
+			DnsName:            "S3.amazonaws.com",
+			AdditionalDnsNames: []string{"s3.eu-west-1.amazonaws.com"},
+		},
+	}
+
+	got := indexDnsNames(es)
+	want := []string{"s3.amazonaws.com", "s3.eu-west-1.amazonaws.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("indexDnsNames() = %v, want %v", got, want)
+	}
+}
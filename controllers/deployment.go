@@ -2,14 +2,17 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"path"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/golang/protobuf/proto"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -20,28 +23,23 @@ import (
 
 // +kubebuilder:rbac:namespace=egress-operator-system,groups=apps,resources=deployments,verbs=get;list;watch;create;patch
 
-var validLogLevels = map[string]bool{
-	"trace":    true,
-	"debug":    true,
-	"info":     true,
-	"warning":  true,
-	"warn":     true,
-	"error":    true,
-	"critical": true,
-	"off":      true,
-}
-
-func (r *ExternalServiceReconciler) reconcileDeployment(ctx context.Context, req ctrl.Request, es *egressv1.ExternalService, configHash string) error {
-	desired := deployment(es, configHash)
+func (r *ExternalServiceReconciler) reconcileDeployment(ctx context.Context, req ctrl.Request, es *egressv1.ExternalService, configHash, secretHash string, podMonitored bool) (*appsv1.Deployment, error) {
+	desired := deployment(es, configHash, secretHash)
+	if prometheusScrapingEnabled() && !podMonitored {
+		mergeMap(prometheusAnnotations(es), desired.Spec.Template.Annotations)
+	}
+	if err := applyPodTemplateOverlays(es, r.DefaultPodTemplateOverlay, &desired.Spec.Template); err != nil {
+		return nil, err
+	}
 	if err := ctrl.SetControllerReference(es, desired, r.Scheme); err != nil {
-		return err
+		return nil, err
 	}
 	d := &appsv1.Deployment{}
 	if err := r.Get(ctx, req.NamespacedName, d); err != nil {
 		if apierrs.IsNotFound(err) {
-			return r.Client.Create(ctx, desired)
+			return desired, r.Client.Create(ctx, desired)
 		}
-		return err
+		return nil, err
 	}
 
 	patched := d.DeepCopy()
@@ -50,7 +48,7 @@ func (r *ExternalServiceReconciler) reconcileDeployment(ctx context.Context, req
 	patched.Spec = desired.Spec
 	patched.Spec.Replicas = d.Spec.Replicas
 
-	return ignoreNotFound(r.patchIfNecessary(ctx, patched, client.MergeFrom(d)))
+	return patched, ignoreNotFound(r.patchIfNecessary(ctx, patched, client.MergeFrom(d)))
 }
 
 func deploymentPorts(es *egressv1.ExternalService) (ports []corev1.ContainerPort) {
@@ -71,16 +69,122 @@ func deploymentPorts(es *egressv1.ExternalService) (ports []corev1.ContainerPort
 	return
 }
 
-func deployment(es *egressv1.ExternalService, configHash string) *appsv1.Deployment {
+const (
+	// tlsSecretsPath is where Secrets referenced by TLS origination are mounted in gateway pods
+	tlsSecretsPath = "/etc/egress-tls"
+	// systemCABundle is the CA bundle shipped in the Envoy image
+	systemCABundle = "/etc/ssl/certs/ca-certificates.crt"
+)
+
+func tlsSecretPath(secretName string) string {
+	return path.Join(tlsSecretsPath, secretName)
+}
+
+// clientCertificateSecretName returns the Secret whose certificate a port presents to the external service,
+// which may be the ExternalService's default client certificate
+func clientCertificateSecretName(es *egressv1.ExternalService, tls *egressv1.TLSOrigination) string {
+	if tls.ClientCertificateSecretName != "" {
+		return tls.ClientCertificateSecretName
+	}
+	return es.ClientCertificateSecretName()
+}
+
+// tlsSecretNames returns the sorted, de-duplicated Secrets referenced by the ExternalService's ports
+func tlsSecretNames(es *egressv1.ExternalService) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, port := range es.Spec.Ports {
+		if port.TLS == nil {
+			continue
+		}
+		for _, name := range []string{port.TLS.CASecretName, clientCertificateSecretName(es, port.TLS)} {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// tlsSecretVolumes mounts each Secret referenced by TLS origination at tlsSecretPath
+func tlsSecretVolumes(es *egressv1.ExternalService) (volumes []corev1.Volume, mounts []corev1.VolumeMount) {
+	for i, name := range tlsSecretNames(es) {
+		volume := fmt.Sprintf("tls-secret-%d", i)
+		volumes = append(volumes, corev1.Volume{
+			Name: volume,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName:  name,
+					DefaultMode: proto.Int32(420),
+				},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      volume,
+			MountPath: tlsSecretPath(name),
+			ReadOnly:  true,
+		})
+	}
+
+	return volumes, mounts
+}
+
+// defaultEnvoyImage is the image gateways run unless their ExternalService sets envoyImage, from ENVOY_IMAGE
+func defaultEnvoyImage() string {
+	if i, ok := os.LookupEnv("ENVOY_IMAGE"); ok {
+		return i
+	}
+	return "envoyproxy/envoy:v1.25.9"
+}
+
+// envoyImageAllowed is true if an ExternalService may run img, which must be the default image or listed in the
+// comma separated ENVOY_IMAGE_ALLOWLIST
+func envoyImageAllowed(img string) bool {
+	if img == defaultEnvoyImage() {
+		return true
+	}
+	allowlist, _ := os.LookupEnv("ENVOY_IMAGE_ALLOWLIST")
+	for _, allowed := range strings.Split(allowlist, ",") {
+		if strings.TrimSpace(allowed) == img {
+			return true
+		}
+	}
+	return false
+}
+
+// checkEnvoyImage refuses to roll out an envoyImage the operator doesn't allow
+func checkEnvoyImage(es *egressv1.ExternalService) error {
+	if es.Spec.EnvoyImage != "" && !envoyImageAllowed(es.Spec.EnvoyImage) {
+		return configInvalidError{fmt.Errorf("envoyImage %s is not in ENVOY_IMAGE_ALLOWLIST", es.Spec.EnvoyImage)}
+	}
+	return nil
+}
+
+// envoyImage is the image an ExternalService's gateway runs, which lets a few gateways canary a new Envoy version
+func envoyImage(es *egressv1.ExternalService) string {
+	if es.Spec.EnvoyImage != "" && envoyImageAllowed(es.Spec.EnvoyImage) {
+		return es.Spec.EnvoyImage
+	}
+	return defaultEnvoyImage()
+}
+
+func deployment(es *egressv1.ExternalService, configHash, secretHash string) *appsv1.Deployment {
 	adPort := adminPort(es)
 	a := annotations(es)
 	a["egress.monzo.com/config-hash"] = configHash
-	a["egress.monzo.com/admin-port"] = strconv.Itoa(int(adPort))
-
-	img := "envoyproxy/envoy:v1.25.9"
-	if i, ok := os.LookupEnv("ENVOY_IMAGE"); ok {
-		img = i
+	if secretHash != "" {
+		a["egress.monzo.com/secret-hash"] = secretHash
 	}
+	a["egress.monzo.com/admin-port"] = strconv.Itoa(int(adPort))
+	a["egress.monzo.com/stats-port"] = strconv.Itoa(int(restrictedAdminPort(es)))
+	ports := append(deploymentPorts(es), corev1.ContainerPort{
+		Name:          "stats",
+		Protocol:      corev1.ProtocolTCP,
+		ContainerPort: restrictedAdminPort(es),
+	})
 
 	labelSelector := metav1.SetAsLabelSelector(labelsToSelect(es))
 
@@ -157,16 +261,7 @@ func deployment(es *egressv1.ExternalService, configHash string) *appsv1.Deploym
 	if es.Spec.Resources != nil {
 		resources = *es.Spec.Resources
 	} else {
-		resources = corev1.ResourceRequirements{
-			Requests: corev1.ResourceList{
-				"cpu":    resource.MustParse("100m"),
-				"memory": resource.MustParse("50Mi"),
-			},
-			Limits: corev1.ResourceList{
-				"cpu":    resource.MustParse("2"),
-				"memory": resource.MustParse("1Gi"),
-			},
-		}
+		resources = egressv1.DefaultResources()
 	}
 	deploymentSpec := appsv1.DeploymentSpec{
 		ProgressDeadlineSeconds: proto.Int(600),
@@ -190,10 +285,10 @@ func deployment(es *egressv1.ExternalService, configHash string) *appsv1.Deploym
 				TopologySpreadConstraints: podTopologySpread,
 				Containers: []corev1.Container{
 					{
-						Name:            "gateway",
-						Image:           img,
+						Name:            egressv1.GatewayContainerName,
+						Image:           envoyImage(es),
 						ImagePullPolicy: corev1.PullIfNotPresent,
-						Ports:           deploymentPorts(es),
+						Ports:           ports,
 						VolumeMounts: []corev1.VolumeMount{
 							{
 								Name:      "envoy-config",
@@ -214,8 +309,8 @@ func deployment(es *egressv1.ExternalService, configHash string) *appsv1.Deploym
 						ReadinessProbe: &corev1.Probe{
 							ProbeHandler: corev1.ProbeHandler{
 								HTTPGet: &corev1.HTTPGetAction{
-									Path:   "/ready",
-									Port:   intstr.FromInt(int(adPort)),
+									Path:   readyPath,
+									Port:   intstr.FromInt(int(restrictedAdminPort(es))),
 									Scheme: corev1.URISchemeHTTP,
 								},
 							},
@@ -255,8 +350,12 @@ func deployment(es *egressv1.ExternalService, configHash string) *appsv1.Deploym
 		},
 	}
 
+	volumes, mounts := tlsSecretVolumes(es)
+	deploymentSpec.Template.Spec.Volumes = append(deploymentSpec.Template.Spec.Volumes, volumes...)
+	deploymentSpec.Template.Spec.Containers[0].VolumeMounts = append(deploymentSpec.Template.Spec.Containers[0].VolumeMounts, mounts...)
+
 	defaultArgs := []string{"-c", "/etc/envoy/envoy.yaml"}
-	if validLogLevels[es.Spec.EnvoyLogLevel] {
+	if egressv1.IsValidEnvoyLogLevel(es.Spec.EnvoyLogLevel) {
 		deploymentSpec.Template.Spec.Containers[0].Args = append(defaultArgs, "--log-level", es.Spec.EnvoyLogLevel)
 	}
 
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/monzo/egress-operator/api/v1"
+)
+
+func Test_deployment_tlsSecrets(t *testing.T) {
+	es := &v1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "example",
+		},
+		Spec: v1.ExternalServiceSpec{
+			DnsName: "example.com",
+			Ports: []v1.ExternalServicePort{
+				{Port: 80, TLS: &v1.TLSOrigination{TargetPort: 443, CASecretName: "example-ca", ClientCertificateSecretName: "example-client"}},
+				{Port: 8080, TLS: &v1.TLSOrigination{TargetPort: 8443, CASecretName: "example-ca"}},
+			},
+		},
+	}
+
+	spec := deployment(es, "hash", "").Spec.Template.Spec
+
+	var secrets []string
+	for _, v := range spec.Volumes {
+		if v.Secret != nil {
+			secrets = append(secrets, v.Secret.SecretName)
+		}
+	}
+	if want := []string{"example-ca", "example-client"}; !reflect.DeepEqual(secrets, want) {
+		t.Errorf("deployment() secret volumes = %v, want %v", secrets, want)
+	}
+
+	var paths []string
+	for _, m := range spec.Containers[0].VolumeMounts {
+		paths = append(paths, m.MountPath)
+	}
+	if want := []string{"/etc/envoy", "/etc/egress-tls/example-ca", "/etc/egress-tls/example-client"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("deployment() volume mounts = %v, want %v", paths, want)
+	}
+}
+
+func Test_deployment_clientCertificate(t *testing.T) {
+	es := &v1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "partner",
+		},
+		Spec: v1.ExternalServiceSpec{
+			DnsName: "api.partner.com",
+			Ports: []v1.ExternalServicePort{
+				{Port: 443, TLS: &v1.TLSOrigination{}},
+				{Port: 8443, TLS: &v1.TLSOrigination{ClientCertificateSecretName: "partner-legacy"}},
+			},
+			ClientCertificate: &v1.ClientCertificate{SecretName: "partner-client"},
+		},
+	}
+
+	if got, want := tlsSecretNames(es), []string{"partner-client", "partner-legacy"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tlsSecretNames() = %v, want %v", got, want)
+	}
+
+	d := deployment(es, "hash", "abcd")
+	if got := d.Spec.Template.Annotations["egress.monzo.com/secret-hash"]; got != "abcd" {
+		t.Errorf("deployment() secret-hash = %v, want abcd", got)
+	}
+
+	if _, ok := deployment(es, "hash", "").Spec.Template.Annotations["egress.monzo.com/secret-hash"]; ok {
+		t.Errorf("deployment() has a secret-hash annotation without a hash")
+	}
+}
+
+func Test_deployment_restrictedAdminPort(t *testing.T) {
+	es := &v1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "example",
+		},
+		Spec: v1.ExternalServiceSpec{
+			DnsName: "example.com",
+			Ports:   []v1.ExternalServicePort{{Port: 443}, {Port: 11000}, {Port: 11002}},
+		},
+	}
+
+	if got := adminPort(es); got != 11001 {
+		t.Errorf("adminPort() = %v, want 11001", got)
+	}
+	if got := restrictedAdminPort(es); got != 11003 {
+		t.Errorf("restrictedAdminPort() = %v, want 11003", got)
+	}
+
+	d := deployment(es, "hash", "")
+	container := d.Spec.Template.Spec.Containers[0]
+	want := corev1.ContainerPort{Name: "stats", Protocol: corev1.ProtocolTCP, ContainerPort: 11003}
+	if got := container.Ports[len(container.Ports)-1]; !reflect.DeepEqual(got, want) {
+		t.Errorf("deployment() ports = %v, want a stats port", container.Ports)
+	}
+	if got := container.ReadinessProbe.HTTPGet.Port.IntValue(); got != 11003 {
+		t.Errorf("deployment() readiness probe port = %v, want 11003", got)
+	}
+	if got := d.Spec.Template.Annotations["egress.monzo.com/stats-port"]; got != "11003" {
+		t.Errorf("deployment() stats-port = %v, want 11003", got)
+	}
+}
+
+func Test_deployment_envoyImage(t *testing.T) {
+	t.Setenv("ENVOY_IMAGE", "envoyproxy/envoy:v1.25.9")
+	t.Setenv("ENVOY_IMAGE_ALLOWLIST", "envoyproxy/envoy:v1.32.3, envoyproxy/envoy:v1.33.0")
+
+	tests := []struct {
+		image     string
+		wantImage string
+		wantErr   bool
+	}{
+		{image: "", wantImage: "envoyproxy/envoy:v1.25.9"},
+		{image: "envoyproxy/envoy:v1.25.9", wantImage: "envoyproxy/envoy:v1.25.9"},
+		{image: "envoyproxy/envoy:v1.33.0", wantImage: "envoyproxy/envoy:v1.33.0"},
+		{image: "attacker/envoy:latest", wantImage: "envoyproxy/envoy:v1.25.9", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			es := &v1.ExternalService{
+				ObjectMeta: metav1.ObjectMeta{Name: "example"},
+				Spec:       v1.ExternalServiceSpec{DnsName: "example.com", EnvoyImage: tt.image},
+			}
+
+			if err := checkEnvoyImage(es); (err != nil) != tt.wantErr || (err != nil && !isConfigInvalid(err)) {
+				t.Errorf("checkEnvoyImage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := deployment(es, "hash", "").Spec.Template.Spec.Containers[0].Image; got != tt.wantImage {
+				t.Errorf("deployment() image = %v, want %v", got, tt.wantImage)
+			}
+		})
+	}
+}
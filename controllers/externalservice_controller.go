@@ -19,16 +19,22 @@ import (
 	"bytes"
 	"context"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 
 	egressv1 "github.com/monzo/egress-operator/api/v1"
 )
@@ -38,14 +44,34 @@ const namespace = "egress-operator-system"
 // ExternalServiceReconciler reconciles a ExternalService object
 type ExternalServiceReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 
 	EnablePodDisruptionBudgets bool
+
+	// OverflowCheckInterval is how often to check gateway stats for circuit breaker overflows, or 0 to not check
+	OverflowCheckInterval time.Duration
+
+	// Xds serves gateways their listeners and clusters if set, instead of writing them into their bootstrap
+	Xds *XdsServer
+
+	// ValidateConfigWithEnvoy runs each new configuration through `envoy --mode validate` in a Job before rolling it out
+	ValidateConfigWithEnvoy bool
+
+	// DefaultAccessLog is the access log configuration each ExternalService's accessLog overrides, if set
+	DefaultAccessLog *egressv1.AccessLog
+
+	// DefaultPodTemplateOverlay is strategic-merged into every gateway's pod template before the ExternalService's
+	// podTemplate, if set
+	DefaultPodTemplateOverlay []byte
+
+	overflow overflowCounts
 }
 
 // +kubebuilder:rbac:groups=egress.monzo.com,resources=externalservices,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=egress.monzo.com,resources=externalservices/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 func (r *ExternalServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("externalservice", req.NamespacedName)
@@ -53,6 +79,10 @@ func (r *ExternalServiceReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	es := &egressv1.ExternalService{}
 	if err := r.Get(ctx, req.NamespacedName, es); err != nil {
 		if apierrs.IsNotFound(err) {
+			if r.Xds != nil {
+				r.Xds.clearResources(req.Name)
+			}
+			r.overflow.forget(req.Name)
 			return ctrl.Result{}, nil
 		}
 		log.Error(err, "unable to fetch ExternalService")
@@ -60,9 +90,62 @@ func (r *ExternalServiceReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	}
 
 	req.Namespace = namespace
+	// Configuration is generated with the operator's defaults filled in. The spec is never written back.
+	es.Spec.AccessLog = withDefaultAccessLog(r.DefaultAccessLog, es.Spec.AccessLog)
+
+	dnsName, owner, err := r.dnsNameOwner(ctx, es)
+	if err != nil {
+		log.Error(err, "unable to determine the owner of the ExternalService's DNS name")
+		return ctrl.Result{}, err
+	}
+	conflicted := owner != es.Name
+	if conflicted && !meta.IsStatusConditionTrue(es.Status.Conditions, egressv1.ConditionConflict) {
+		r.Recorder.Eventf(es, corev1.EventTypeWarning, "DnsNameConflict",
+			"dnsName %s is already claimed by ExternalService %s, DNS will not be hijacked to this gateway", dnsName, owner)
+	}
 
-	desiredConfigMap, configHash, err := configmap(es)
+	desiredConfigMap, configHash, err := configmap(es, r.Xds)
+	if err == nil {
+		err = checkEnvoyImage(es)
+	}
+	if err == nil && r.ValidateConfigWithEnvoy {
+		var validated bool
+		validated, err = r.validateConfigWithEnvoy(ctx, es)
+		if err == nil && !validated {
+			// Nothing is rolled out until the validation Job passes, which triggers another reconcile
+			if err := r.reconcileStatus(ctx, es, observed{configValidating: true, dnsName: dnsName, dnsNameOwner: owner}); err != nil {
+				log.Error(err, "unable to update ExternalService status")
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{}, nil
+		}
+	}
+	var xdsHeldBack bool
+	if err == nil && r.Xds != nil {
+		var mounted bool
+		if mounted, err = r.tlsSecretsMounted(ctx, es); err == nil && mounted {
+			// Pushed first, so that any gateway pods started for this change find their configuration
+			err = r.Xds.setResources(ctx, es)
+		} else if err == nil {
+			// Envoy rejects configuration reading Secrets it doesn't mount, so it's pushed once the Deployment
+			// has rolled out with them
+			_, err = xdsSnapshot(es)
+			xdsHeldBack = true
+		}
+	}
 	if err != nil {
+		invalid := isConfigInvalid(err)
+		if c := meta.FindStatusCondition(es.Status.Conditions, egressv1.ConditionConfigValid); invalid && (c == nil || c.Message != err.Error()) {
+			r.Recorder.Eventf(es, corev1.EventTypeWarning, "ConfigInvalid",
+				"Envoy configuration rejected, gateways keep their last valid configuration: %v", err)
+		}
+		if err := r.reconcileStatus(ctx, es, observed{configErr: err, dnsName: dnsName, dnsNameOwner: owner}); err != nil {
+			log.Error(err, "unable to update ExternalService status")
+		}
+		// Only a change to the spec can fix an invalid configuration
+		if invalid {
+			return ctrl.Result{}, nil
+		}
 		return ctrl.Result{}, err
 	}
 	if err := r.reconcileConfigMap(ctx, req, es, desiredConfigMap); err != nil {
@@ -70,7 +153,25 @@ func (r *ExternalServiceReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		return ctrl.Result{}, err
 	}
 
-	if err := r.reconcileDeployment(ctx, req, es, configHash); err != nil {
+	if err := r.reconcileCertificate(ctx, req, es); err != nil {
+		log.Error(err, "unable to reconcile Certificate")
+		return ctrl.Result{}, err
+	}
+
+	secretHash, err := r.tlsSecretsHash(ctx, es)
+	if err != nil {
+		log.Error(err, "unable to hash TLS Secrets")
+		return ctrl.Result{}, err
+	}
+
+	podMonitored, err := r.reconcilePodMonitor(ctx, req, es)
+	if err != nil {
+		log.Error(err, "unable to reconcile PodMonitor")
+		return ctrl.Result{}, err
+	}
+
+	d, err := r.reconcileDeployment(ctx, req, es, configHash, secretHash, podMonitored)
+	if err != nil {
 		log.Error(err, "unable to reconcile Deployment")
 		return ctrl.Result{}, err
 	}
@@ -85,7 +186,8 @@ func (r *ExternalServiceReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		return ctrl.Result{}, err
 	}
 
-	if err := r.reconcileService(ctx, req, es); err != nil {
+	s, err := r.reconcileService(ctx, req, es, conflicted)
+	if err != nil {
 		log.Error(err, "unable to reconcile Service")
 		return ctrl.Result{}, err
 	}
@@ -97,7 +199,40 @@ func (r *ExternalServiceReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		}
 	}
 
-	return ctrl.Result{}, nil
+	o := observed{
+		deployment:   d,
+		service:      s,
+		configHash:   configHash,
+		dnsName:      dnsName,
+		dnsNameOwner: owner,
+	}
+
+	var result ctrl.Result
+	if r.OverflowCheckInterval > 0 {
+		overflows, wait, err := r.checkOverflow(ctx, es)
+		if err != nil {
+			log.Error(err, "unable to check gateway stats for circuit breaker overflows")
+			return ctrl.Result{}, err
+		}
+		o.overflowChecked = true
+		o.overflows = overflows
+		if overflows > 0 && !meta.IsStatusConditionTrue(es.Status.Conditions, egressv1.ConditionCircuitBreakerOverflow) {
+			r.Recorder.Eventf(es, corev1.EventTypeWarning, "CircuitBreakerOverflow",
+				"%d connections to the external service were rejected by circuit breakers", overflows)
+		}
+		result.RequeueAfter = wait
+	}
+	if xdsHeldBack && (result.RequeueAfter == 0 || result.RequeueAfter > xdsRolloutRecheckInterval) {
+		// The Deployment's status changes as it rolls out, but the last old pod may still be shutting down
+		result.RequeueAfter = xdsRolloutRecheckInterval
+	}
+
+	if err := r.reconcileStatus(ctx, es, o); err != nil {
+		log.Error(err, "unable to update ExternalService status")
+		return ctrl.Result{}, err
+	}
+
+	return result, nil
 }
 
 func labels(es *egressv1.ExternalService) map[string]string {
@@ -111,6 +246,10 @@ func annotations(es *egressv1.ExternalService) map[string]string {
 	annotations := map[string]string{
 		"egress.monzo.com/dns-name": es.Spec.DnsName,
 	}
+	// Only added when there are aliases so that existing gateways aren't rolled
+	if len(es.Spec.AdditionalDnsNames) > 0 {
+		annotations["egress.monzo.com/dns-names"] = strings.Join(es.Spec.DnsNames(), ",")
+	}
 	// Allow setting the topology aware routing annotation
 	value, ok := os.LookupEnv("ENABLE_SERVICE_TOPOLOGY_MODE")
 	if ok && value == "true" {
@@ -130,14 +269,27 @@ func labelsToSelect(es *egressv1.ExternalService) map[string]string {
 }
 
 func (r *ExternalServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &egressv1.ExternalService{}, dnsNameField, indexDnsNames); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &egressv1.ExternalService{}, tlsSecretField, indexTlsSecrets); err != nil {
+		return err
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&egressv1.ExternalService{}).
+		Watches(&egressv1.ExternalService{}, handler.EnqueueRequestsFromMapFunc(r.externalServicesSharingDnsName)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.externalServicesReferencingSecret)).
 		Owns(&networkingv1.NetworkPolicy{}).
 		Owns(&corev1.Service{}).
 		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.ConfigMap{}).
-		Owns(&autoscalingv1.HorizontalPodAutoscaler{}).
-		Complete(r)
+		Owns(&autoscalingv1.HorizontalPodAutoscaler{})
+	if r.ValidateConfigWithEnvoy {
+		b = b.Owns(&batchv1.Job{})
+	}
+
+	return b.Complete(r)
 }
 
 func ignoreNotFound(err error) error {
@@ -164,6 +316,19 @@ func (r *ExternalServiceReconciler) patchIfNecessary(ctx context.Context, obj cl
 	return r.Client.Patch(ctx, obj, patch, opts...)
 }
 
+func (r *ExternalServiceReconciler) patchStatusIfNecessary(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(data, emptyPatch) {
+		return nil
+	}
+
+	return r.Client.Status().Patch(ctx, obj, patch, opts...)
+}
+
 func mergeMap(from, to map[string]string) {
 	for k, v := range from {
 		to[k] = v
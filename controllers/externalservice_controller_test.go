@@ -136,7 +136,7 @@ func assertState(key types.NamespacedName, es *v1.ExternalService) {
 	const timeout = time.Second * 30
 	const interval = time.Second * 1
 
-	cTarget, cHash, err := configmap(es)
+	cTarget, cHash, err := configmap(es, nil)
 	Expect(err).To(BeNil())
 
 	Eventually(func() *appsv1.Deployment {
@@ -147,9 +147,9 @@ func assertState(key types.NamespacedName, es *v1.ExternalService) {
 
 		return d
 	}, timeout, interval).Should(And(
-		WithTransform(func(d *appsv1.Deployment) appsv1.DeploymentSpec { return d.Spec }, BeComparableTo(deployment(es, cHash).Spec)),
+		WithTransform(func(d *appsv1.Deployment) appsv1.DeploymentSpec { return d.Spec }, BeComparableTo(deployment(es, cHash, "").Spec)),
 		assertOwner(key.Name),
-		assertLabels(deployment(es, cHash)),
+		assertLabels(deployment(es, cHash, "")),
 	))
 
 	Eventually(func() *networkingv1.NetworkPolicy {
@@ -158,9 +158,9 @@ func assertState(key types.NamespacedName, es *v1.ExternalService) {
 
 		return n
 	}, timeout, interval).Should(And(
-		WithTransform(func(d *networkingv1.NetworkPolicy) networkingv1.NetworkPolicySpec { return d.Spec }, BeComparableTo(networkPolicy(es).Spec)),
+		WithTransform(func(d *networkingv1.NetworkPolicy) networkingv1.NetworkPolicySpec { return d.Spec }, BeComparableTo(networkPolicy(es, false).Spec)),
 		assertOwner(key.Name),
-		assertLabels(networkPolicy(es)),
+		assertLabels(networkPolicy(es, false)),
 	))
 
 	Eventually(func() *corev1.Service {
@@ -174,9 +174,9 @@ func assertState(key types.NamespacedName, es *v1.ExternalService) {
 
 		return s
 	}, timeout, interval).Should(And(
-		WithTransform(func(d *corev1.Service) corev1.ServiceSpec { return d.Spec }, BeComparableTo(service(es, true, nil).Spec)),
+		WithTransform(func(d *corev1.Service) corev1.ServiceSpec { return d.Spec }, BeComparableTo(service(es, true, false, nil).Spec)),
 		assertOwner(key.Name),
-		assertLabels(service(es, true, nil)),
+		assertLabels(service(es, true, false, nil)),
 	))
 
 	Eventually(func() *corev1.ConfigMap {
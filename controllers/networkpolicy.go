@@ -17,7 +17,7 @@ import (
 // +kubebuilder:rbac:namespace=egress-operator-system,groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;patch
 
 func (r *ExternalServiceReconciler) reconcileNetworkPolicy(ctx context.Context, req ctrl.Request, es *egressv1.ExternalService) error {
-	desired := networkPolicy(es)
+	desired := networkPolicy(es, r.OverflowCheckInterval > 0)
 	if err := ctrl.SetControllerReference(es, desired, r.Scheme); err != nil {
 		return err
 	}
@@ -55,8 +55,11 @@ func networkPolicyPorts(es *egressv1.ExternalService) (ports []networkingv1.Netw
 	return
 }
 
-func networkPolicy(es *egressv1.ExternalService) *networkingv1.NetworkPolicy {
-	return &networkingv1.NetworkPolicy{
+// networkPolicy only admits allowed clients to the gateway ports. If allowOperator is set, the operator can also
+// read stats from the restricted admin listener, and if Prometheus scraping is enabled so can anyone. The admin
+// interface itself only listens on localhost.
+func networkPolicy(es *egressv1.ExternalService, allowOperator bool) *networkingv1.NetworkPolicy {
+	np := &networkingv1.NetworkPolicy{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        es.Name,
 			Namespace:   namespace,
@@ -84,4 +87,30 @@ func networkPolicy(es *egressv1.ExternalService) *networkingv1.NetworkPolicy {
 			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
 		},
 	}
+
+	if allowOperator {
+		tcp := corev1.ProtocolTCP
+		p := intstr.FromInt(int(restrictedAdminPort(es)))
+		np.Spec.Ingress = append(np.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{
+				{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"control-plane": "controller-manager"},
+					},
+				},
+			},
+			Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &p}},
+		})
+	}
+
+	if prometheusScrapingEnabled() {
+		tcp := corev1.ProtocolTCP
+		p := intstr.FromInt(int(restrictedAdminPort(es)))
+		// The restricted admin listener only serves readiness and stats, so it's open to Prometheus wherever it runs
+		np.Spec.Ingress = append(np.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &p}},
+		})
+	}
+
+	return np
 }
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:rbac:namespace=egress-operator-system,groups=core,resources=pods,verbs=get;list;watch
+
+// overflowStat is incremented by Envoy whenever a cluster's connection circuit breaker rejects a connection
+const overflowStat = "envoy_cluster_upstream_cx_overflow"
+
+var statsClient = &http.Client{Timeout: 2 * time.Second}
+
+// overflowCounts remembers the last sample of each ExternalService's gateway pods, by ExternalService
+type overflowCounts struct {
+	sync.Mutex
+	samples map[string]*overflowSample
+}
+
+// overflowSample is each gateway pod's upstream_cx_overflow total at a check, and how much they grew since the
+// previous one. Samples are replaced rather than changed, so they can be read without holding the lock.
+type overflowSample struct {
+	at     time.Time
+	counts map[types.UID]uint64
+	growth uint64
+}
+
+func (c *overflowCounts) get(name string) *overflowSample {
+	c.Lock()
+	defer c.Unlock()
+	return c.samples[name]
+}
+
+func (c *overflowCounts) set(name string, sample *overflowSample) {
+	c.Lock()
+	defer c.Unlock()
+	if c.samples == nil {
+		c.samples = map[string]*overflowSample{}
+	}
+	c.samples[name] = sample
+}
+
+// forget drops a deleted ExternalService's sample
+func (c *overflowCounts) forget(name string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.samples, name)
+}
+
+// checkOverflow returns how much upstream_cx_overflow grew across an ExternalService's gateway pods over the last
+// check interval, and how long until the next check. Pods are sampled at most once per interval however often the
+// ExternalService is reconciled, so a reconcile triggered by a status update doesn't start a new, shorter window.
+// Pods seen for the first time only set a baseline, so restarting the operator doesn't report old overflows.
+func (r *ExternalServiceReconciler) checkOverflow(ctx context.Context, es *egressv1.ExternalService) (uint64, time.Duration, error) {
+	previous := r.overflow.get(es.Name)
+	if previous != nil {
+		if wait := r.OverflowCheckInterval - time.Since(previous.at); wait > 0 {
+			return previous.growth, wait, nil
+		}
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(namespace), client.MatchingLabels(labelsToSelect(es))); err != nil {
+		return 0, 0, err
+	}
+
+	sample := &overflowSample{at: time.Now(), counts: map[types.UID]uint64{}}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" {
+			continue
+		}
+
+		prev, seen := uint64(0), false
+		if previous != nil {
+			prev, seen = previous.counts[pod.UID]
+		}
+
+		count, err := fetchOverflowCount(ctx, pod.Status.PodIP, restrictedAdminPort(es))
+		if err != nil {
+			r.Log.Info("unable to fetch gateway stats", "pod", pod.Name, "error", err.Error())
+			if seen {
+				sample.counts[pod.UID] = prev
+			}
+			continue
+		}
+
+		// Counters only go backwards if Envoy restarted
+		if seen && count > prev {
+			sample.growth += count - prev
+		}
+		sample.counts[pod.UID] = count
+	}
+	r.overflow.set(es.Name, sample)
+
+	return sample.growth, r.OverflowCheckInterval, nil
+}
+
+func fetchOverflowCount(ctx context.Context, ip string, port int32) (uint64, error) {
+	url := fmt.Sprintf("http://%s/stats/prometheus?filter=upstream_cx_overflow", net.JoinHostPort(ip, strconv.Itoa(int(port))))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := statsClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return parseOverflowCount(resp.Body)
+}
+
+// parseOverflowCount sums upstream_cx_overflow over every cluster in Prometheus text output
+func parseOverflowCount(r io.Reader) (uint64, error) {
+	var total uint64
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, overflowStat+"{") && !strings.HasPrefix(line, overflowStat+" ") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		value, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse %q: %w", line, err)
+		}
+		total += uint64(value)
+	}
+
+	return total, scanner.Err()
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+func Test_parseOverflowCount(t *testing.T) {
+	stats := `# TYPE envoy_cluster_upstream_cx_overflow counter
+envoy_cluster_upstream_cx_overflow{envoy_cluster_name="google_TCP_443"} 3
+envoy_cluster_upstream_cx_overflow{envoy_cluster_name="google_TCP_80"} 4
+# TYPE envoy_cluster_upstream_cx_overflow_total counter
+envoy_cluster_upstream_cx_overflow_total 100
+`
+
+	got, err := parseOverflowCount(strings.NewReader(stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 7 {
+		t.Errorf("parseOverflowCount() = %v, want 7", got)
+	}
+}
+
+func Test_checkOverflow_interval(t *testing.T) {
+	r := &ExternalServiceReconciler{OverflowCheckInterval: time.Minute}
+	es := &egressv1.ExternalService{ObjectMeta: metav1.ObjectMeta{Name: "google"}}
+	r.overflow.set("google", &overflowSample{at: time.Now().Add(-20 * time.Second), growth: 5})
+
+	// Within the interval the last result is reported without sampling, which would need a client
+	growth, wait, err := r.checkOverflow(context.Background(), es)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if growth != 5 {
+		t.Errorf("checkOverflow() = %v, want the last check's growth", growth)
+	}
+	if wait <= 0 || wait > 40*time.Second {
+		t.Errorf("checkOverflow() wait = %v, want the rest of the interval", wait)
+	}
+
+	r.overflow.forget("google")
+	if r.overflow.get("google") != nil {
+		t.Errorf("forget() kept the sample")
+	}
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+// ParseDefaultPodTemplateOverlay parses and validates the operator-wide overlay applied to every gateway's pod
+// template, a JSON or YAML partial PodTemplateSpec set in DEFAULT_POD_TEMPLATE_OVERLAY. It returns the overlay as JSON,
+// or nil if value is empty.
+func ParseDefaultPodTemplateOverlay(value string) ([]byte, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	overlay, err := yaml.YAMLToJSON([]byte(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DEFAULT_POD_TEMPLATE_OVERLAY: %w", err)
+	}
+	if errs := egressv1.ValidatePodTemplate(overlay, field.NewPath("DEFAULT_POD_TEMPLATE_OVERLAY")); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+
+	return overlay, nil
+}
+
+// applyPodTemplateOverlays strategic-merges the operator's default overlay and then the ExternalService's podTemplate into a
+// gateway's generated pod template, so containers, volumes and env vars are merged by name. The generated labels and
+// annotations are restored afterwards, as the Deployment's selector, config hash and stats port depend on them, and so
+// are the gateway container's image, command and args, so the Envoy image allow-list can't be bypassed.
+func applyPodTemplateOverlays(es *egressv1.ExternalService, defaultOverlay []byte, template *corev1.PodTemplateSpec) error {
+	var overlay []byte
+	if es.Spec.PodTemplate != nil {
+		overlay = es.Spec.PodTemplate.Raw
+		// Checked here too, as the webhooks may not be enabled
+		if errs := egressv1.ValidatePodTemplate(overlay, field.NewPath("spec", "podTemplate")); len(errs) > 0 {
+			return configInvalidError{errs.ToAggregate()}
+		}
+	}
+	if len(defaultOverlay) == 0 && len(overlay) == 0 {
+		return nil
+	}
+
+	merged, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+	if len(defaultOverlay) > 0 {
+		if merged, err = strategicpatch.StrategicMergePatch(merged, defaultOverlay, corev1.PodTemplateSpec{}); err != nil {
+			return fmt.Errorf("unable to apply DEFAULT_POD_TEMPLATE_OVERLAY: %w", err)
+		}
+	}
+	if len(overlay) > 0 {
+		if merged, err = strategicpatch.StrategicMergePatch(merged, overlay, corev1.PodTemplateSpec{}); err != nil {
+			return configInvalidError{fmt.Errorf("unable to apply podTemplate: %w", err)}
+		}
+	}
+
+	result := corev1.PodTemplateSpec{}
+	if err := json.Unmarshal(merged, &result); err != nil {
+		return err
+	}
+	if result.Labels == nil {
+		result.Labels = map[string]string{}
+	}
+	mergeMap(template.Labels, result.Labels)
+	if result.Annotations == nil {
+		result.Annotations = map[string]string{}
+	}
+	mergeMap(template.Annotations, result.Annotations)
+
+	generated, overlaid := gatewayContainer(template), gatewayContainer(&result)
+	if generated == nil || overlaid == nil {
+		return configInvalidError{fmt.Errorf("pod template overlays must not remove the %s container", egressv1.GatewayContainerName)}
+	}
+	overlaid.Image = generated.Image
+	overlaid.Command = generated.Command
+	overlaid.Args = generated.Args
+	*template = result
+
+	return nil
+}
+
+// applyPodLevelOverlays gives another pod for the gateway, such as its validation Job's, the pod-level settings from
+// the gateway's overlays, so it can pull the same images and is treated the same by admission controllers and meshes.
+// Annotations the operator sets on gateway pods aren't copied.
+func applyPodLevelOverlays(es *egressv1.ExternalService, defaultOverlay []byte, template *corev1.PodTemplateSpec) error {
+	generated := deployment(es, "", "").Spec.Template
+	gateway := *generated.DeepCopy()
+	if err := applyPodTemplateOverlays(es, defaultOverlay, &gateway); err != nil {
+		return err
+	}
+
+	for k, v := range gateway.Annotations {
+		if _, ok := generated.Annotations[k]; ok {
+			continue
+		}
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[k] = v
+	}
+	template.Spec.ImagePullSecrets = gateway.Spec.ImagePullSecrets
+	template.Spec.ServiceAccountName = gateway.Spec.ServiceAccountName
+	template.Spec.PriorityClassName = gateway.Spec.PriorityClassName
+
+	return nil
+}
+
+func gatewayContainer(template *corev1.PodTemplateSpec) *corev1.Container {
+	for i := range template.Spec.Containers {
+		if template.Spec.Containers[i].Name == egressv1.GatewayContainerName {
+			return &template.Spec.Containers[i]
+		}
+	}
+	return nil
+}
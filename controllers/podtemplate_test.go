@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+func Test_applyPodTemplateOverlays(t *testing.T) {
+	defaultOverlay, err := ParseDefaultPodTemplateOverlay(`
+metadata:
+  annotations:
+    sidecar.istio.io/inject: "false"
+spec:
+  priorityClassName: egress
+  imagePullSecrets:
+  - name: registry
+`)
+	if err != nil {
+		t.Fatalf("ParseDefaultPodTemplateOverlay() error = %v", err)
+	}
+
+	es := &egressv1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{Name: "example"},
+		Spec: egressv1.ExternalServiceSpec{
+			DnsName: "example.com",
+			Ports:   []egressv1.ExternalServicePort{{Port: 443}},
+			PodTemplate: &runtime.RawExtension{Raw: []byte(`{
+				"metadata": {
+					"labels": {"team": "payments", "egress.monzo.com/gateway": "other"},
+					"annotations": {"egress.monzo.com/config-hash": "forged"}
+				},
+				"spec": {
+					"priorityClassName": "egress-critical",
+					"containers": [
+						{"name": "gateway", "env": [{"name": "FOO", "value": "bar"}]},
+						{"name": "log-shipper", "image": "fluent/fluent-bit:3.0"}
+					]
+				}
+			}`)},
+		},
+	}
+
+	template := deployment(es, "hash", "").Spec.Template
+	if err := applyPodTemplateOverlays(es, defaultOverlay, &template); err != nil {
+		t.Fatalf("applyPodTemplateOverlays() error = %v", err)
+	}
+
+	if got := template.Spec.PriorityClassName; got != "egress-critical" {
+		t.Errorf("applyPodTemplateOverlays() priorityClassName = %v, want the ExternalService's to win", got)
+	}
+	if got := template.Spec.ImagePullSecrets; !reflect.DeepEqual(got, []corev1.LocalObjectReference{{Name: "registry"}}) {
+		t.Errorf("applyPodTemplateOverlays() imagePullSecrets = %v", got)
+	}
+	if got := template.Annotations["sidecar.istio.io/inject"]; got != "false" {
+		t.Errorf("applyPodTemplateOverlays() default annotation = %v", got)
+	}
+	if got := template.Labels["team"]; got != "payments" {
+		t.Errorf("applyPodTemplateOverlays() label = %v", got)
+	}
+	if got := template.Labels["egress.monzo.com/gateway"]; got != "example" {
+		t.Errorf("applyPodTemplateOverlays() gateway label = %v, want it restored", got)
+	}
+	if got := template.Annotations["egress.monzo.com/config-hash"]; got != "hash" {
+		t.Errorf("applyPodTemplateOverlays() config-hash = %v, want it restored", got)
+	}
+
+	if len(template.Spec.Containers) != 2 || template.Spec.Containers[1].Name != "log-shipper" {
+		t.Fatalf("applyPodTemplateOverlays() containers = %v, want a sidecar", template.Spec.Containers)
+	}
+	gateway := template.Spec.Containers[0]
+	if gateway.Image == "" || gateway.ReadinessProbe == nil {
+		t.Errorf("applyPodTemplateOverlays() lost the gateway container's generated fields: %v", gateway)
+	}
+	var env []string
+	for _, e := range gateway.Env {
+		env = append(env, e.Name)
+	}
+	if !reflect.DeepEqual(env, []string{"FOO", "ENVOY_UID"}) {
+		t.Errorf("applyPodTemplateOverlays() gateway env = %v, want FOO merged with ENVOY_UID", env)
+	}
+}
+
+func Test_ParseDefaultPodTemplateOverlay_invalid(t *testing.T) {
+	if _, err := ParseDefaultPodTemplateOverlay(`{"spec": {"containers": "gateway"}}`); err == nil {
+		t.Errorf("ParseDefaultPodTemplateOverlay() expected an error")
+	}
+}
+
+func Test_applyPodTemplateOverlays_gatewayContainer(t *testing.T) {
+	t.Setenv("ENVOY_IMAGE", "envoyproxy/envoy:v1.25.9")
+
+	for name, overlay := range map[string]string{
+		"image":   `{"spec":{"containers":[{"name":"gateway","image":"attacker/envoy:latest"}]}}`,
+		"command": `{"spec":{"containers":[{"name":"gateway","command":["/bin/sh"]}]}}`,
+		"removed": `{"spec":{"containers":[{"name":"gateway","$patch":"delete"}]}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			es := &egressv1.ExternalService{
+				ObjectMeta: metav1.ObjectMeta{Name: "example"},
+				Spec: egressv1.ExternalServiceSpec{
+					DnsName:     "example.com",
+					PodTemplate: &runtime.RawExtension{Raw: []byte(overlay)},
+				},
+			}
+
+			template := deployment(es, "hash", "").Spec.Template
+			if err := applyPodTemplateOverlays(es, nil, &template); !isConfigInvalid(err) {
+				t.Errorf("applyPodTemplateOverlays() error = %v, want a configInvalidError", err)
+			}
+			if got := template.Spec.Containers[0].Image; got != "envoyproxy/envoy:v1.25.9" {
+				t.Errorf("applyPodTemplateOverlays() image = %v, want it unchanged", got)
+			}
+		})
+	}
+}
+
+func Test_applyPodLevelOverlays(t *testing.T) {
+	defaultOverlay := []byte(`{"metadata":{"annotations":{"sidecar.istio.io/inject":"false"}},"spec":{"imagePullSecrets":[{"name":"registry"}]}}`)
+
+	es := &egressv1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{Name: "example"},
+		Spec: egressv1.ExternalServiceSpec{
+			DnsName: "example.com",
+			PodTemplate: &runtime.RawExtension{Raw: []byte(`{"spec":{
+				"serviceAccountName": "egress",
+				"priorityClassName": "egress-critical",
+				"containers": [{"name": "log-shipper", "image": "fluent/fluent-bit:3.0"}]
+			}}`)},
+		},
+	}
+
+	job := validationJob(es, "example-validate-abc")
+	if err := applyPodLevelOverlays(es, defaultOverlay, &job.Spec.Template); err != nil {
+		t.Fatalf("applyPodLevelOverlays() error = %v", err)
+	}
+
+	template := job.Spec.Template
+	if got := template.Spec.ImagePullSecrets; !reflect.DeepEqual(got, []corev1.LocalObjectReference{{Name: "registry"}}) {
+		t.Errorf("applyPodLevelOverlays() imagePullSecrets = %v", got)
+	}
+	if template.Spec.ServiceAccountName != "egress" || template.Spec.PriorityClassName != "egress-critical" {
+		t.Errorf("applyPodLevelOverlays() spec = %+v", template.Spec)
+	}
+	if !reflect.DeepEqual(template.Annotations, map[string]string{"sidecar.istio.io/inject": "false"}) {
+		t.Errorf("applyPodLevelOverlays() annotations = %v, want only the overlay's", template.Annotations)
+	}
+	if len(template.Spec.Containers) != 1 {
+		t.Errorf("applyPodLevelOverlays() containers = %v, want no sidecars", template.Spec.Containers)
+	}
+}
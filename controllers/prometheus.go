@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strconv"
+
+	metricsv3 "github.com/envoyproxy/go-control-plane/envoy/config/metrics/v3"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+// +kubebuilder:rbac:namespace=egress-operator-system,groups=monitoring.coreos.com,resources=podmonitors,verbs=get;list;watch;create;patch
+
+// statsPath is where the restricted admin listener serves Envoy's stats in Prometheus format
+const statsPath = "/stats/prometheus"
+
+var podMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PodMonitor"}
+
+// prometheusScrapingEnabled is true if gateways should serve their stats to Prometheus on the stats port
+func prometheusScrapingEnabled() bool {
+	value, ok := os.LookupEnv("ENABLE_PROMETHEUS_SCRAPING")
+	return ok && value == "true"
+}
+
+// statsTags tags every stat with the ExternalService's name, and cluster stats with the port they serve, so
+// dashboards can break traffic down by destination
+func statsTags(es *egressv1.ExternalService) *metricsv3.StatsConfig {
+	return &metricsv3.StatsConfig{
+		StatsTags: []*metricsv3.TagSpecifier{
+			{
+				TagName:  "external_service",
+				TagValue: &metricsv3.TagSpecifier_FixedValue{FixedValue: es.Name},
+			},
+			{
+				TagName: "external_service_port",
+				TagValue: &metricsv3.TagSpecifier_Regex{
+					Regex: `^cluster\.` + regexp.QuoteMeta(es.Name) + `_(?:TCP|UDP)_((\d+))(?:-aggregate|-override)?\.`,
+				},
+			},
+		},
+	}
+}
+
+// prometheusAnnotations are the conventional pod annotations which tell Prometheus where to scrape, used when the
+// Prometheus Operator isn't installed
+func prometheusAnnotations(es *egressv1.ExternalService) map[string]string {
+	return map[string]string{
+		"prometheus.io/scrape": "true",
+		"prometheus.io/port":   strconv.Itoa(int(restrictedAdminPort(es))),
+		"prometheus.io/path":   statsPath,
+	}
+}
+
+func podMonitor(es *egressv1.ExternalService) *unstructured.Unstructured {
+	pm := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"selector": map[string]interface{}{
+					"matchLabels": stringMap(labelsToSelect(es)),
+				},
+				"podMetricsEndpoints": []interface{}{
+					map[string]interface{}{
+						"port": "stats",
+						"path": statsPath,
+					},
+				},
+			},
+		},
+	}
+	pm.SetGroupVersionKind(podMonitorGVK)
+	pm.SetName(es.Name)
+	pm.SetNamespace(namespace)
+	pm.SetLabels(labels(es))
+	pm.SetAnnotations(annotations(es))
+
+	return pm
+}
+
+func stringMap(m map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// reconcilePodMonitor creates a PodMonitor for the gateway if Prometheus scraping is enabled and the Prometheus
+// Operator's CRDs are installed. It returns whether the gateway is scraped through a PodMonitor.
+func (r *ExternalServiceReconciler) reconcilePodMonitor(ctx context.Context, req ctrl.Request, es *egressv1.ExternalService) (bool, error) {
+	if !prometheusScrapingEnabled() {
+		return false, nil
+	}
+
+	if _, err := r.RESTMapper().RESTMapping(podMonitorGVK.GroupKind(), podMonitorGVK.Version); err != nil {
+		if meta.IsNoMatchError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	desired := podMonitor(es)
+	if err := ctrl.SetControllerReference(es, desired, r.Scheme); err != nil {
+		return false, err
+	}
+	pm := &unstructured.Unstructured{}
+	pm.SetGroupVersionKind(podMonitorGVK)
+	if err := r.Get(ctx, req.NamespacedName, pm); err != nil {
+		if apierrs.IsNotFound(err) {
+			return true, r.Client.Create(ctx, desired)
+		}
+		return false, err
+	}
+
+	patched := pm.DeepCopy()
+	patchedLabels := patched.GetLabels()
+	if patchedLabels == nil {
+		patchedLabels = map[string]string{}
+	}
+	mergeMap(desired.GetLabels(), patchedLabels)
+	patched.SetLabels(patchedLabels)
+	patchedAnnotations := patched.GetAnnotations()
+	if patchedAnnotations == nil {
+		patchedAnnotations = map[string]string{}
+	}
+	mergeMap(desired.GetAnnotations(), patchedAnnotations)
+	patched.SetAnnotations(patchedAnnotations)
+	patched.Object["spec"] = desired.Object["spec"]
+
+	return true, ignoreNotFound(r.patchIfNecessary(ctx, patched, client.MergeFrom(pm)))
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+func prometheusExternalService() *egressv1.ExternalService {
+	tcp := corev1.ProtocolTCP
+	return &egressv1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"},
+		Spec: egressv1.ExternalServiceSpec{
+			DnsName: "example.com",
+			Ports:   []egressv1.ExternalServicePort{{Port: 443, Protocol: &tcp}},
+		},
+	}
+}
+
+func Test_envoyConfig_prometheusScraping(t *testing.T) {
+	t.Setenv("ENABLE_PROMETHEUS_SCRAPING", "true")
+
+	want := `admin:
+  accessLog:
+  - name: envoy.stdout_access_log
+    typedConfig:
+      '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+      logFormat:
+        contentType: application/json; charset=UTF-8
+        omitEmptyValues: true
+        textFormatSource:
+          inlineString: |
+            [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+  address:
+    socketAddress:
+      address: 127.0.0.1
+      portValue: 11000
+node:
+  cluster: foo
+staticResources:
+  clusters:
+  - connectTimeout: 1s
+    dnsLookupFamily: V4_ONLY
+    loadAssignment:
+      clusterName: foo_TCP_443
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: example.com
+                portValue: 443
+    name: foo_TCP_443
+    type: LOGICAL_DNS
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 3
+        keepaliveTime: 30
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
+  listeners:
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 443
+    filterChains:
+    - filters:
+      - name: envoy.tcp_proxy
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+          accessLog:
+          - name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    [%START_TIME%] %BYTES_RECEIVED% %BYTES_SENT% %DURATION% "%DOWNSTREAM_REMOTE_ADDRESS%" "%UPSTREAM_HOST%" "%UPSTREAM_CLUSTER%"
+          cluster: foo_TCP_443
+          statPrefix: tcp_proxy
+    name: foo_TCP_443
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
+statsConfig:
+  statsTags:
+  - fixedValue: foo
+    tagName: external_service
+  - regex: ^cluster\.foo_(?:TCP|UDP)_((\d+))(?:-aggregate|-override)?\.
+    tagName: external_service_port
+`
+	got, err := envoyConfig(prometheusExternalService())
+	if err != nil {
+		t.Fatalf("envoyConfig() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("envoyConfig() = %v, want %v", got, want)
+	}
+}
+
+func Test_prometheusAnnotations(t *testing.T) {
+	want := map[string]string{
+		"prometheus.io/scrape": "true",
+		"prometheus.io/port":   "11001",
+		"prometheus.io/path":   "/stats/prometheus",
+	}
+	if got := prometheusAnnotations(prometheusExternalService()); !reflect.DeepEqual(got, want) {
+		t.Errorf("prometheusAnnotations() = %v, want %v", got, want)
+	}
+}
+
+func Test_podMonitor(t *testing.T) {
+	pm := podMonitor(prometheusExternalService())
+
+	if pm.GetKind() != "PodMonitor" || pm.GetNamespace() != namespace || pm.GetName() != "foo" {
+		t.Errorf("podMonitor() = %s %s/%s", pm.GetKind(), pm.GetNamespace(), pm.GetName())
+	}
+	want := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{"egress.monzo.com/gateway": "foo"},
+		},
+		"podMetricsEndpoints": []interface{}{
+			map[string]interface{}{"port": "stats", "path": "/stats/prometheus"},
+		},
+	}
+	if got := pm.Object["spec"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("podMonitor() spec = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+// +kubebuilder:rbac:namespace=egress-operator-system,groups=core,resources=secrets,verbs=get;list;watch
+
+// tlsSecretField indexes ExternalServices by the Secrets mounted into their gateway pods
+const tlsSecretField = ".spec.tlsSecrets"
+
+func indexTlsSecrets(o client.Object) []string {
+	es, ok := o.(*egressv1.ExternalService)
+	if !ok {
+		return nil
+	}
+
+	return tlsSecretNames(es)
+}
+
+// tlsSecretsHash hashes the content of the Secrets mounted into gateway pods, as Envoy only reads
+// certificates from disk when it starts. Missing Secrets are hashed too, so that pods which couldn't
+// start are replaced once the Secret is created.
+func (r *ExternalServiceReconciler) tlsSecretsHash(ctx context.Context, es *egressv1.ExternalService) (string, error) {
+	names := tlsSecretNames(es)
+	if len(names) == 0 {
+		return "", nil
+	}
+
+	h := fnv.New32a()
+	for _, name := range names {
+		s := &corev1.Secret{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, s); err != nil {
+			if apierrs.IsNotFound(err) {
+				fmt.Fprintf(h, "%s missing\n", name)
+				continue
+			}
+			return "", err
+		}
+
+		keys := make([]string, 0, len(s.Data))
+		for k := range s.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(h, "%s/%s %d\n", name, k, len(s.Data[k]))
+			h.Write(s.Data[k])
+		}
+	}
+
+	return fmt.Sprintf("%x", h.Sum32()), nil
+}
+
+// tlsSecretsMounted is true if every gateway pod mounts the Secrets referenced by the ExternalService, so Envoy can
+// read them. Pods shutting down are ignored.
+func (r *ExternalServiceReconciler) tlsSecretsMounted(ctx context.Context, es *egressv1.ExternalService) (bool, error) {
+	names := tlsSecretNames(es)
+	if len(names) == 0 {
+		return true, nil
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(namespace), client.MatchingLabels(labelsToSelect(es))); err != nil {
+		return false, err
+	}
+
+	return podsMountSecrets(pods.Items, names), nil
+}
+
+func podsMountSecrets(pods []corev1.Pod, names []string) bool {
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		mounted := map[string]bool{}
+		for _, v := range pod.Spec.Volumes {
+			if v.Secret != nil {
+				mounted[v.Secret.SecretName] = true
+			}
+		}
+		for _, name := range names {
+			if !mounted[name] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// externalServicesReferencingSecret maps a Secret to the ExternalServices whose gateways mount it
+func (r *ExternalServiceReconciler) externalServicesReferencingSecret(ctx context.Context, o client.Object) []reconcile.Request {
+	if o.GetNamespace() != namespace {
+		return nil
+	}
+
+	list := &egressv1.ExternalServiceList{}
+	if err := r.List(ctx, list, client.MatchingFields{tlsSecretField: o.GetName()}); err != nil {
+		r.Log.Error(err, "unable to list ExternalServices referencing Secret", "secret", o.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, es := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKey{Name: es.Name}})
+	}
+
+	return requests
+}
@@ -18,10 +18,10 @@ import (
 
 // +kubebuilder:rbac:namespace=egress-operator-system,groups=core,resources=services,verbs=get;list;watch;create;patch
 
-func (r *ExternalServiceReconciler) reconcileService(ctx context.Context, req ctrl.Request, es *egressv1.ExternalService) error {
+func (r *ExternalServiceReconciler) reconcileService(ctx context.Context, req ctrl.Request, es *egressv1.ExternalService, conflicted bool) (*corev1.Service, error) {
 	d := &appsv1.Deployment{}
 	if err := r.Get(ctx, req.NamespacedName, d); err != nil && !apierrs.IsNotFound(err) {
-		return err
+		return nil, err
 	}
 
 	podsReady := d.Status.ReadyReplicas > 0
@@ -29,19 +29,19 @@ func (r *ExternalServiceReconciler) reconcileService(ctx context.Context, req ct
 	s := &corev1.Service{}
 	if err := r.Get(ctx, req.NamespacedName, s); err != nil {
 		if apierrs.IsNotFound(err) {
-			desired := service(es, podsReady, nil)
+			desired := service(es, podsReady, conflicted, nil)
 			if err := ctrl.SetControllerReference(es, desired, r.Scheme); err != nil {
-				return err
+				return nil, err
 			}
 
-			return r.Client.Create(ctx, desired)
+			return desired, r.Client.Create(ctx, desired)
 		}
-		return err
+		return nil, err
 	}
 
-	desired := service(es, podsReady, s)
+	desired := service(es, podsReady, conflicted, s)
 	if err := ctrl.SetControllerReference(es, desired, r.Scheme); err != nil {
-		return err
+		return nil, err
 	}
 
 	patched := s.DeepCopy()
@@ -49,8 +49,13 @@ func (r *ExternalServiceReconciler) reconcileService(ctx context.Context, req ct
 	mergeMap(desired.Annotations, patched.Annotations)
 	patched.Spec = desired.Spec
 	patched.Spec.ClusterIP = s.Spec.ClusterIP
+	// Without an ipFamily the cluster picks the Service's families, so keep whatever it chose
+	if es.Spec.IpFamily == "" {
+		patched.Spec.IPFamilies = s.Spec.IPFamilies
+		patched.Spec.IPFamilyPolicy = s.Spec.IPFamilyPolicy
+	}
 
-	return ignoreNotFound(r.patchIfNecessary(ctx, patched, client.MergeFrom(s)))
+	return patched, ignoreNotFound(r.patchIfNecessary(ctx, patched, client.MergeFrom(s)))
 }
 
 func servicePorts(es *egressv1.ExternalService) (ports []corev1.ServicePort) {
@@ -73,13 +78,34 @@ func servicePorts(es *egressv1.ExternalService) (ports []corev1.ServicePort) {
 	return
 }
 
-func service(es *egressv1.ExternalService, ready bool, current *corev1.Service) *corev1.Service {
+// ipFamilies returns the Service families for an ExternalService, primary first
+func ipFamilies(es *egressv1.ExternalService) ([]corev1.IPFamily, *corev1.IPFamilyPolicy) {
+	single, dual := corev1.IPFamilyPolicySingleStack, corev1.IPFamilyPolicyRequireDualStack
+	switch es.Spec.IpFamily {
+	case egressv1.IpFamilyIPv4:
+		return []corev1.IPFamily{corev1.IPv4Protocol}, &single
+	case egressv1.IpFamilyIPv6:
+		return []corev1.IPFamily{corev1.IPv6Protocol}, &single
+	case egressv1.IpFamilyDualStackPreferIPv4:
+		return []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol}, &dual
+	case egressv1.IpFamilyDualStackPreferIPv6:
+		return []corev1.IPFamily{corev1.IPv6Protocol, corev1.IPv4Protocol}, &dual
+	default:
+		return nil, nil
+	}
+}
+
+func service(es *egressv1.ExternalService, ready, conflicted bool, current *corev1.Service) *corev1.Service {
 	l := labels(es)
 	switch {
 	// Easy case; if hijacking is disabled, don't hijack
 	case !es.Spec.HijackDns:
 		l["egress.monzo.com/hijack-dns"] = "false"
 
+	// Another ExternalService owns our DnsName, so leave hijacking to its gateway
+	case conflicted:
+		l["egress.monzo.com/hijack-dns"] = "false"
+
 	// Easy case: pods are ready
 	case ready:
 		l["egress.monzo.com/hijack-dns"] = "true"
@@ -102,18 +128,31 @@ func service(es *egressv1.ExternalService, ready bool, current *corev1.Service)
 		l["egress.monzo.com/hijack-dns"] = "waiting-for-pods"
 	}
 
+	a := annotations(es)
+	families, familyPolicy := ipFamilies(es)
+	// The CoreDNS plugin answers queries for families the gateway doesn't have itself
+	if families != nil {
+		var f []string
+		for _, family := range families {
+			f = append(f, string(family))
+		}
+		a["egress.monzo.com/ip-families"] = strings.Join(f, ",")
+	}
+
 	return &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        es.Name,
 			Namespace:   namespace,
 			Labels:      l,
-			Annotations: annotations(es),
+			Annotations: a,
 		},
 		Spec: corev1.ServiceSpec{
 			Selector:        labelsToSelect(es),
 			Ports:           servicePorts(es),
 			SessionAffinity: corev1.ServiceAffinityNone,
 			Type:            corev1.ServiceTypeClusterIP,
+			IPFamilies:      families,
+			IPFamilyPolicy:  familyPolicy,
 		},
 	}
 }
@@ -111,9 +111,87 @@ func Test_service(t *testing.T) {
 				}
 			}
 
-			if got := service(es, tt.ready, current); !reflect.DeepEqual(got.Labels["egress.monzo.com/hijack-dns"], tt.wantState) {
+			if got := service(es, tt.ready, false, current); !reflect.DeepEqual(got.Labels["egress.monzo.com/hijack-dns"], tt.wantState) {
 				t.Errorf("service() state = %v, want %v", got.Labels["egress.monzo.com/hijack-dns"], tt.wantState)
 			}
 		})
 	}
 }
+
+func Test_service_conflicted(t *testing.T) {
+	es := &v1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "google-2",
+		},
+		Spec: v1.ExternalServiceSpec{
+			HijackDns: true,
+			DnsName:   "google.com",
+			Ports: []v1.ExternalServicePort{
+				{Port: 443},
+			},
+		},
+	}
+	current := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"egress.monzo.com/hijack-dns": "true"},
+		},
+	}
+
+	if got := service(es, true, true, current); got.Labels["egress.monzo.com/hijack-dns"] != "false" {
+		t.Errorf("service() state = %v, want false", got.Labels["egress.monzo.com/hijack-dns"])
+	}
+}
+
+func Test_service_additionalDnsNames(t *testing.T) {
+	es := &v1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "s3",
+		},
+		Spec: v1.ExternalServiceSpec{
+			DnsName:            "s3.amazonaws.com",
+			AdditionalDnsNames: []string{"s3.eu-west-1.amazonaws.com", "s3-eu-west-1.amazonaws.com"},
+			Ports: []v1.ExternalServicePort{
+				{Port: 443},
+			},
+		},
+	}
+
+	got := service(es, true, false, nil)
+	if got.Annotations["egress.monzo.com/dns-name"] != "s3.amazonaws.com" {
+		t.Errorf("service() dns-name = %v, want s3.amazonaws.com", got.Annotations["egress.monzo.com/dns-name"])
+	}
+	if want := "s3.amazonaws.com,s3.eu-west-1.amazonaws.com,s3-eu-west-1.amazonaws.com"; got.Annotations["egress.monzo.com/dns-names"] != want {
+		t.Errorf("service() dns-names = %v, want %v", got.Annotations["egress.monzo.com/dns-names"], want)
+	}
+}
+
+func Test_service_ipFamily(t *testing.T) {
+	es := &v1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "google",
+		},
+		Spec: v1.ExternalServiceSpec{
+			DnsName:  "google.com",
+			IpFamily: v1.IpFamilyDualStackPreferIPv6,
+			Ports: []v1.ExternalServicePort{
+				{Port: 443},
+			},
+		},
+	}
+
+	got := service(es, true, false, nil)
+	if want := []corev1.IPFamily{corev1.IPv6Protocol, corev1.IPv4Protocol}; !reflect.DeepEqual(got.Spec.IPFamilies, want) {
+		t.Errorf("service() ipFamilies = %v, want %v", got.Spec.IPFamilies, want)
+	}
+	if got.Spec.IPFamilyPolicy == nil || *got.Spec.IPFamilyPolicy != corev1.IPFamilyPolicyRequireDualStack {
+		t.Errorf("service() ipFamilyPolicy = %v, want RequireDualStack", got.Spec.IPFamilyPolicy)
+	}
+	if got.Annotations["egress.monzo.com/ip-families"] != "IPv6,IPv4" {
+		t.Errorf("service() ip-families = %v, want IPv6,IPv4", got.Annotations["egress.monzo.com/ip-families"])
+	}
+
+	es.Spec.IpFamily = ""
+	if got := service(es, true, false, nil); got.Spec.IPFamilies != nil || got.Spec.IPFamilyPolicy != nil {
+		t.Errorf("service() without ipFamily = %v %v, want unset", got.Spec.IPFamilies, got.Spec.IPFamilyPolicy)
+	}
+}
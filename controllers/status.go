@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+// observed is the state of an ExternalService's gateway resources gathered during a reconcile
+type observed struct {
+	// deployment and service may be nil if reconciliation stopped before they were reconciled
+	deployment *appsv1.Deployment
+	service    *corev1.Service
+
+	configHash string
+	configErr  error
+	// configValidating is true while a validation Job is checking the configuration
+	configValidating bool
+
+	// dnsNameOwner is the ExternalService which owns dnsName, which may not be the one being reconciled.
+	// dnsName is the first of the ExternalService's names claimed by another ExternalService, or DnsName.
+	dnsName      string
+	dnsNameOwner string
+
+	// overflows is how much upstream_cx_overflow grew since the last check, if overflowChecked
+	overflowChecked bool
+	overflows       uint64
+}
+
+func (r *ExternalServiceReconciler) reconcileStatus(ctx context.Context, es *egressv1.ExternalService, o observed) error {
+	patched := es.DeepCopy()
+	setStatus(&patched.Status, es, o)
+
+	return ignoreNotFound(r.patchStatusIfNecessary(ctx, patched, client.MergeFrom(es)))
+}
+
+// setStatus records the observed state of the gateway resources on status. Conditions about resources
+// missing from o are left untouched.
+func setStatus(status *egressv1.ExternalServiceStatus, es *egressv1.ExternalService, o observed) {
+	generation := es.Generation
+	status.ObservedGeneration = generation
+
+	switch {
+	case o.configErr != nil:
+		reason := "ConfigGenerationFailed"
+		if isConfigInvalid(o.configErr) {
+			reason = "ConfigInvalid"
+		}
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               egressv1.ConditionConfigValid,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: generation,
+			Reason:             reason,
+			Message:            o.configErr.Error(),
+		})
+	case o.configValidating:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               egressv1.ConditionConfigValid,
+			Status:             metav1.ConditionUnknown,
+			ObservedGeneration: generation,
+			Reason:             "Validating",
+			Message:            "Envoy is validating the configuration",
+		})
+	default:
+		status.ConfigHash = o.configHash
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               egressv1.ConditionConfigValid,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: generation,
+			Reason:             "ConfigGenerated",
+			Message:            "Envoy configuration generated",
+		})
+	}
+
+	conflicted := o.dnsNameOwner != "" && o.dnsNameOwner != es.Name
+	if o.dnsNameOwner != "" {
+		conflict := metav1.Condition{
+			Type:               egressv1.ConditionConflict,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: generation,
+			Reason:             "DnsNameOwned",
+			Message:            fmt.Sprintf("%s is not claimed by any other ExternalService", strings.Join(es.Spec.DnsNames(), ", ")),
+		}
+		if conflicted {
+			conflict.Status = metav1.ConditionTrue
+			conflict.Reason = "DnsNameConflict"
+			conflict.Message = fmt.Sprintf("%s is already claimed by ExternalService %s", o.dnsName, o.dnsNameOwner)
+		}
+		meta.SetStatusCondition(&status.Conditions, conflict)
+	}
+
+	if o.overflowChecked {
+		overflow := metav1.Condition{
+			Type:               egressv1.ConditionCircuitBreakerOverflow,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: generation,
+			Reason:             "NoOverflow",
+			Message:            "No connections were rejected by circuit breakers since the last check",
+		}
+		if o.overflows > 0 {
+			overflow.Status = metav1.ConditionTrue
+			overflow.Reason = "UpstreamConnectionOverflow"
+			overflow.Message = fmt.Sprintf("%d connections were rejected by circuit breakers since the last check", o.overflows)
+		}
+		meta.SetStatusCondition(&status.Conditions, overflow)
+	}
+
+	if d := o.deployment; d != nil {
+		var desired int32
+		if d.Spec.Replicas != nil {
+			desired = *d.Spec.Replicas
+		} else {
+			desired = d.Status.Replicas
+		}
+		status.ReadyReplicas = d.Status.ReadyReplicas
+		status.DesiredReplicas = desired
+
+		message := fmt.Sprintf("%d/%d gateway pods ready", status.ReadyReplicas, status.DesiredReplicas)
+
+		ready := metav1.Condition{
+			Type:               egressv1.ConditionReady,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: generation,
+			Reason:             "GatewayPodsReady",
+			Message:            message,
+		}
+		if status.ReadyReplicas == 0 {
+			ready.Status = metav1.ConditionFalse
+			ready.Reason = "NoGatewayPodsReady"
+		}
+		meta.SetStatusCondition(&status.Conditions, ready)
+
+		degraded := metav1.Condition{
+			Type:               egressv1.ConditionDegraded,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: generation,
+			Reason:             "AllReplicasReady",
+			Message:            message,
+		}
+		if status.ReadyReplicas < status.DesiredReplicas {
+			degraded.Status = metav1.ConditionTrue
+			degraded.Reason = "InsufficientReplicas"
+		}
+		meta.SetStatusCondition(&status.Conditions, degraded)
+	}
+
+	if s := o.service; s != nil {
+		status.ClusterIP = s.Spec.ClusterIP
+		status.HijackDns = s.Labels["egress.monzo.com/hijack-dns"]
+
+		hijack := metav1.Condition{
+			Type:               egressv1.ConditionDnsHijackActive,
+			ObservedGeneration: generation,
+		}
+		switch {
+		case status.HijackDns == "true":
+			hijack.Status = metav1.ConditionTrue
+			hijack.Reason = "Hijacking"
+			hijack.Message = "DNS queries for the external service resolve to the gateway Service"
+		case status.HijackDns == "waiting-for-pods":
+			hijack.Status = metav1.ConditionFalse
+			hijack.Reason = "WaitingForPods"
+			hijack.Message = "DNS hijacking will start once a gateway pod is ready"
+		case es.Spec.HijackDns && conflicted:
+			hijack.Status = metav1.ConditionFalse
+			hijack.Reason = "DnsNameConflict"
+			hijack.Message = fmt.Sprintf("DNS queries for %s are hijacked by ExternalService %s", o.dnsName, o.dnsNameOwner)
+		default:
+			hijack.Status = metav1.ConditionFalse
+			hijack.Reason = "HijackDisabled"
+			hijack.Message = "hijackDns is not enabled"
+		}
+		meta.SetStatusCondition(&status.Conditions, hijack)
+	}
+}
@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	v1 "github.com/monzo/egress-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_setStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		ready         int32
+		desired       int32
+		hijack        string
+		configErr     error
+		wantReady     metav1.ConditionStatus
+		wantDegraded  metav1.ConditionStatus
+		wantHijack    metav1.ConditionStatus
+		wantConfigOK  metav1.ConditionStatus
+		wantHijackDns string
+	}{
+		{
+			"all-ready",
+			3,
+			3,
+			"true",
+			nil,
+			metav1.ConditionTrue,
+			metav1.ConditionFalse,
+			metav1.ConditionTrue,
+			metav1.ConditionTrue,
+			"true",
+		},
+		{
+			"partially-ready",
+			1,
+			3,
+			"false",
+			nil,
+			metav1.ConditionTrue,
+			metav1.ConditionTrue,
+			metav1.ConditionFalse,
+			metav1.ConditionTrue,
+			"false",
+		},
+		{
+			"none-ready",
+			0,
+			3,
+			"waiting-for-pods",
+			nil,
+			metav1.ConditionFalse,
+			metav1.ConditionTrue,
+			metav1.ConditionFalse,
+			metav1.ConditionTrue,
+			"waiting-for-pods",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &appsv1.Deployment{
+				Spec:   appsv1.DeploymentSpec{Replicas: proto.Int32(tt.desired)},
+				Status: appsv1.DeploymentStatus{ReadyReplicas: tt.ready},
+			}
+			s := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"egress.monzo.com/hijack-dns": tt.hijack},
+				},
+				Spec: corev1.ServiceSpec{ClusterIP: "10.0.0.1"},
+			}
+
+			es := &v1.ExternalService{ObjectMeta: metav1.ObjectMeta{Name: "google", Generation: 2}}
+			status := &v1.ExternalServiceStatus{}
+			setStatus(status, es, observed{deployment: d, service: s, configHash: "abc", configErr: tt.configErr})
+
+			for condition, want := range map[string]metav1.ConditionStatus{
+				v1.ConditionReady:           tt.wantReady,
+				v1.ConditionDegraded:        tt.wantDegraded,
+				v1.ConditionDnsHijackActive: tt.wantHijack,
+				v1.ConditionConfigValid:     tt.wantConfigOK,
+			} {
+				if got := meta.FindStatusCondition(status.Conditions, condition); got == nil || got.Status != want {
+					t.Errorf("setStatus() condition %s = %v, want %v", condition, got, want)
+				}
+			}
+			if status.HijackDns != tt.wantHijackDns {
+				t.Errorf("setStatus() hijackDns = %v, want %v", status.HijackDns, tt.wantHijackDns)
+			}
+			if status.ClusterIP != "10.0.0.1" || status.ConfigHash != "abc" || status.ObservedGeneration != 2 {
+				t.Errorf("setStatus() = %+v", status)
+			}
+		})
+	}
+
+	t.Run("config-error", func(t *testing.T) {
+		es := &v1.ExternalService{ObjectMeta: metav1.ObjectMeta{Name: "google", Generation: 1}}
+		status := &v1.ExternalServiceStatus{ConfigHash: "old"}
+		setStatus(status, es, observed{configErr: errors.New("boom")})
+
+		if got := meta.FindStatusCondition(status.Conditions, v1.ConditionConfigValid); got == nil || got.Status != metav1.ConditionFalse {
+			t.Errorf("setStatus() ConfigValid = %v, want False", got)
+		}
+		if status.ConfigHash != "old" {
+			t.Errorf("setStatus() configHash = %v, want last rolled out hash to be kept", status.ConfigHash)
+		}
+	})
+
+	t.Run("config-invalid", func(t *testing.T) {
+		es := &v1.ExternalService{ObjectMeta: metav1.ObjectMeta{Name: "google", Generation: 1}}
+		status := &v1.ExternalServiceStatus{ConfigHash: "old"}
+		setStatus(status, es, observed{configErr: configInvalidError{errors.New("boom")}})
+
+		if got := meta.FindStatusCondition(status.Conditions, v1.ConditionConfigValid); got == nil || got.Reason != "ConfigInvalid" {
+			t.Errorf("setStatus() ConfigValid = %v, want reason ConfigInvalid", got)
+		}
+		if status.ConfigHash != "old" {
+			t.Errorf("setStatus() configHash = %v, want last rolled out hash to be kept", status.ConfigHash)
+		}
+	})
+
+	t.Run("config-validating", func(t *testing.T) {
+		es := &v1.ExternalService{ObjectMeta: metav1.ObjectMeta{Name: "google", Generation: 1}}
+		status := &v1.ExternalServiceStatus{ConfigHash: "old"}
+		setStatus(status, es, observed{configHash: "new", configValidating: true})
+
+		if got := meta.FindStatusCondition(status.Conditions, v1.ConditionConfigValid); got == nil || got.Status != metav1.ConditionUnknown {
+			t.Errorf("setStatus() ConfigValid = %v, want Unknown", got)
+		}
+		if status.ConfigHash != "old" {
+			t.Errorf("setStatus() configHash = %v, want last rolled out hash to be kept", status.ConfigHash)
+		}
+	})
+}
+
+func Test_setStatus_conflict(t *testing.T) {
+	es := &v1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{Name: "google-2"},
+		Spec:       v1.ExternalServiceSpec{DnsName: "google.com", HijackDns: true},
+	}
+	s := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"egress.monzo.com/hijack-dns": "false"},
+		},
+	}
+
+	status := &v1.ExternalServiceStatus{}
+	setStatus(status, es, observed{service: s, dnsName: "google.com", dnsNameOwner: "google"})
+
+	if got := meta.FindStatusCondition(status.Conditions, v1.ConditionConflict); got == nil || got.Status != metav1.ConditionTrue {
+		t.Errorf("setStatus() Conflict = %v, want True", got)
+	}
+	if got := meta.FindStatusCondition(status.Conditions, v1.ConditionDnsHijackActive); got == nil || got.Reason != "DnsNameConflict" {
+		t.Errorf("setStatus() DnsHijackActive = %v, want reason DnsNameConflict", got)
+	}
+
+	setStatus(status, es, observed{service: s, dnsName: "google.com", dnsNameOwner: "google-2"})
+	if got := meta.FindStatusCondition(status.Conditions, v1.ConditionConflict); got == nil || got.Status != metav1.ConditionFalse {
+		t.Errorf("setStatus() Conflict = %v, want False", got)
+	}
+}
+
+func Test_setStatus_overflow(t *testing.T) {
+	es := &v1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{Name: "google"},
+		Spec:       v1.ExternalServiceSpec{DnsName: "google.com"},
+	}
+
+	status := &v1.ExternalServiceStatus{}
+	setStatus(status, es, observed{})
+	if got := meta.FindStatusCondition(status.Conditions, v1.ConditionCircuitBreakerOverflow); got != nil {
+		t.Errorf("setStatus() CircuitBreakerOverflow = %v, want unset when not checked", got)
+	}
+
+	setStatus(status, es, observed{overflowChecked: true, overflows: 5})
+	if got := meta.FindStatusCondition(status.Conditions, v1.ConditionCircuitBreakerOverflow); got == nil || got.Status != metav1.ConditionTrue {
+		t.Errorf("setStatus() CircuitBreakerOverflow = %v, want True", got)
+	}
+
+	setStatus(status, es, observed{overflowChecked: true})
+	if got := meta.FindStatusCondition(status.Conditions, v1.ConditionCircuitBreakerOverflow); got == nil || got.Status != metav1.ConditionFalse {
+		t.Errorf("setStatus() CircuitBreakerOverflow = %v, want False", got)
+	}
+}
@@ -77,6 +77,7 @@ var _ = BeforeSuite(func(done Done) {
 		Client:                     k8sManager.GetClient(),
 		Log:                        ctrl.Log.WithName("controllers").WithName("ExternalService"),
 		Scheme:                     scheme.Scheme,
+		Recorder:                   k8sManager.GetEventRecorderFor("egress-operator"),
 		EnablePodDisruptionBudgets: true,
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	envoyv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoycorev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tracev3 "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
+	hcmv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tracingv3 "github.com/envoyproxy/go-control-plane/envoy/type/tracing/v3"
+	envoytypev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+// tracingClusterName is the cluster gateways send spans to the collector through
+const tracingClusterName = "tracing_collector"
+
+// tracingCollector is the host:port of the OpenTelemetry collector http mode gateways send spans to, from
+// TRACING_OTLP_ADDRESS. Tracing is disabled if it's empty.
+func tracingCollector() (string, error) {
+	address, ok := os.LookupEnv("TRACING_OTLP_ADDRESS")
+	if !ok || address == "" {
+		return "", nil
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host == "" {
+		return "", fmt.Errorf("invalid TRACING_OTLP_ADDRESS %q: must be host:port", address)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("invalid TRACING_OTLP_ADDRESS %q: must have a valid port", address)
+	}
+
+	return address, nil
+}
+
+// tracingSamplePercent is the percentage of requests traced, from TRACING_SAMPLE_PERCENT, or nil to use Envoy's
+// default of every request
+func tracingSamplePercent() (*envoytypev3.Percent, error) {
+	value, ok := os.LookupEnv("TRACING_SAMPLE_PERCENT")
+	if !ok || value == "" {
+		return nil, nil
+	}
+
+	percent, err := strconv.ParseFloat(value, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return nil, fmt.Errorf("invalid TRACING_SAMPLE_PERCENT %q: must be a number between 0 and 100", value)
+	}
+
+	return &envoytypev3.Percent{Value: percent}, nil
+}
+
+// generateTracing configures Envoy's OpenTelemetry tracer for an http mode port, so each request through the gateway
+// becomes a span of the caller's trace, sent through the collector's cluster. W3C trace context headers are read from
+// the request and propagated upstream. Envoy tags the span with the upstream host and response flags itself.
+func generateTracing(es *egressv1.ExternalService) (*hcmv3.HttpConnectionManager_Tracing, error) {
+	collector, err := tracingCollector()
+	if err != nil || collector == "" {
+		return nil, err
+	}
+
+	sampling, err := tracingSamplePercent()
+	if err != nil {
+		return nil, err
+	}
+
+	tracerConfig, err := anypb.New(&tracev3.OpenTelemetryConfig{
+		GrpcService: &envoycorev3.GrpcService{
+			TargetSpecifier: &envoycorev3.GrpcService_EnvoyGrpc_{
+				EnvoyGrpc: &envoycorev3.GrpcService_EnvoyGrpc{
+					ClusterName: tracingClusterName,
+				},
+			},
+		},
+		ServiceName: es.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &hcmv3.HttpConnectionManager_Tracing{
+		RandomSampling: sampling,
+		CustomTags: []*tracingv3.CustomTag{{
+			Tag: "egress.external_service",
+			Type: &tracingv3.CustomTag_Literal_{
+				Literal: &tracingv3.CustomTag_Literal{Value: es.Name},
+			},
+		}},
+		Provider: &tracev3.Tracing_Http{
+			Name:       "envoy.tracers.opentelemetry",
+			ConfigType: &tracev3.Tracing_Http_TypedConfig{TypedConfig: tracerConfig},
+		},
+	}, nil
+}
+
+// tracingClusters returns the collector's cluster if tracing is enabled and the ExternalService has an http mode port
+// to trace. Gateway pods use the node's DNS resolver, so TRACING_OTLP_ADDRESS must be an IP or a name the node can
+// resolve.
+func tracingClusters(es *egressv1.ExternalService) ([]*envoyv3.Cluster, error) {
+	collector, err := tracingCollector()
+	if err != nil || collector == "" {
+		return nil, err
+	}
+	for _, port := range es.Spec.Ports {
+		if port.IsHTTP() {
+			cluster, err := generateGrpcCluster(tracingClusterName, collector)
+			if err != nil {
+				return nil, err
+			}
+			return []*envoyv3.Cluster{cluster}, nil
+		}
+	}
+
+	return nil, nil
+}
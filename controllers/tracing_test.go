@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	envoyv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	tracev3 "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+func Test_generateTracing(t *testing.T) {
+	es := &egressv1.ExternalService{ObjectMeta: metav1.ObjectMeta{Name: "vendor"}}
+
+	tracing, err := generateTracing(es)
+	if err != nil || tracing != nil {
+		t.Fatalf("generateTracing() without a collector = %v, %v, want nil", tracing, err)
+	}
+
+	t.Setenv("TRACING_OTLP_ADDRESS", "10.96.0.60:4317")
+	t.Setenv("TRACING_SAMPLE_PERCENT", "2.5")
+	tracing, err = generateTracing(es)
+	if err != nil {
+		t.Fatalf("generateTracing() error = %v", err)
+	}
+	if got := tracing.Provider.Name; got != "envoy.tracers.opentelemetry" {
+		t.Errorf("generateTracing() provider = %v", got)
+	}
+	if got := tracing.RandomSampling.GetValue(); got != 2.5 {
+		t.Errorf("generateTracing() sampling = %v, want 2.5", got)
+	}
+	if got := tracing.CustomTags[0].GetLiteral().GetValue(); got != "vendor" {
+		t.Errorf("generateTracing() external service tag = %v, want vendor", got)
+	}
+	config := &tracev3.OpenTelemetryConfig{}
+	if err := tracing.Provider.GetTypedConfig().UnmarshalTo(config); err != nil {
+		t.Fatalf("generateTracing() config error = %v", err)
+	}
+	if got := config.GrpcService.GetEnvoyGrpc().GetClusterName(); got != tracingClusterName {
+		t.Errorf("generateTracing() cluster = %v, want %v", got, tracingClusterName)
+	}
+
+	for name, value := range map[string]string{
+		"TRACING_OTLP_ADDRESS":   "otel-collector.monitoring",
+		"TRACING_SAMPLE_PERCENT": "150",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := generateTracing(es); err == nil {
+				t.Errorf("generateTracing() with %s=%s expected an error", name, value)
+			}
+		})
+	}
+}
+
+func Test_envoyConfig_tracing(t *testing.T) {
+	t.Setenv("TRACING_OTLP_ADDRESS", "10.96.0.60:4317")
+	t.Setenv("TRACING_SAMPLE_PERCENT", "10")
+
+	tcp := corev1.ProtocolTCP
+	es := &egressv1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"},
+		Spec: egressv1.ExternalServiceSpec{
+			DnsName: "example.com",
+			Ports:   []egressv1.ExternalServicePort{{Port: 80, Protocol: &tcp, Mode: egressv1.PortModeHTTP}},
+		},
+	}
+
+	want := `admin:
+  accessLog:
+  - name: envoy.stdout_access_log
+    typedConfig:
+      '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+      logFormat:
+        contentType: application/json; charset=UTF-8
+        omitEmptyValues: true
+        textFormatSource:
+          inlineString: |
+            [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+  address:
+    socketAddress:
+      address: 127.0.0.1
+      portValue: 11000
+node:
+  cluster: foo
+staticResources:
+  clusters:
+  - connectTimeout: 1s
+    dnsLookupFamily: V4_ONLY
+    loadAssignment:
+      clusterName: foo_TCP_80
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: example.com
+                portValue: 80
+    name: foo_TCP_80
+    type: LOGICAL_DNS
+    upstreamConnectionOptions:
+      tcpKeepalive:
+        keepaliveInterval: 5
+        keepaliveProbes: 3
+        keepaliveTime: 30
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: tracing_collector
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 10.96.0.60
+                portValue: 4317
+    name: tracing_collector
+    type: STATIC
+    typedExtensionProtocolOptions:
+      envoy.extensions.upstreams.http.v3.HttpProtocolOptions:
+        '@type': type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions
+        explicitHttpConfig:
+          http2ProtocolOptions: {}
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: envoy_admin
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 127.0.0.1
+                portValue: 11000
+    name: envoy_admin
+    type: STATIC
+  listeners:
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 80
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          accessLog:
+          - name: envoy.stdout_access_log
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+              logFormat:
+                contentType: application/json; charset=UTF-8
+                omitEmptyValues: true
+                textFormatSource:
+                  inlineString: |
+                    [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%DOWNSTREAM_REMOTE_ADDRESS%" "%REQ(USER-AGENT)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%" "%UPSTREAM_CLUSTER%"
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: external_service
+            virtualHosts:
+            - domains:
+              - example.com
+              name: external_service
+              routes:
+              - match:
+                  prefix: /
+                route:
+                  cluster: foo_TCP_80
+              - directResponse:
+                  status: 403
+                match:
+                  prefix: /
+            - domains:
+              - '*'
+              name: forbidden
+              routes:
+              - directResponse:
+                  status: 403
+                match:
+                  prefix: /
+          statPrefix: http
+          stripAnyHostPort: true
+          tracing:
+            customTags:
+            - literal:
+                value: foo
+              tag: egress.external_service
+            provider:
+              name: envoy.tracers.opentelemetry
+              typedConfig:
+                '@type': type.googleapis.com/envoy.config.trace.v3.OpenTelemetryConfig
+                grpcService:
+                  envoyGrpc:
+                    clusterName: tracing_collector
+                serviceName: foo
+            randomSampling:
+              value: 10
+    name: foo_TCP_80
+  - address:
+      socketAddress:
+        address: 0.0.0.0
+        portValue: 11001
+    filterChains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typedConfig:
+          '@type': type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          httpFilters:
+          - name: envoy.filters.http.router
+            typedConfig:
+              '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+          routeConfig:
+            name: restricted_admin
+            virtualHosts:
+            - domains:
+              - '*'
+              name: restricted_admin
+              routes:
+              - match:
+                  path: /ready
+                route:
+                  cluster: envoy_admin
+              - match:
+                  path: /stats/prometheus
+                route:
+                  cluster: envoy_admin
+          statPrefix: restricted_admin
+    name: restricted_admin
+`
+	got, err := envoyConfig(es)
+	if err != nil {
+		t.Fatalf("envoyConfig() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("envoyConfig() = %v, want %v", got, want)
+	}
+}
+
+func Test_tracingClusters(t *testing.T) {
+	tcp := corev1.ProtocolTCP
+	es := &egressv1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+		Spec: egressv1.ExternalServiceSpec{
+			DnsName: "example.com",
+			Ports:   []egressv1.ExternalServicePort{{Port: 443, Protocol: &tcp}},
+		},
+	}
+
+	t.Setenv("TRACING_OTLP_ADDRESS", "10.96.0.60:4317")
+	if clusters, err := tracingClusters(es); err != nil || len(clusters) != 0 {
+		t.Errorf("tracingClusters() without an http mode port = %v, %v, want none", clusters, err)
+	}
+
+	es.Spec.Ports = append(es.Spec.Ports, egressv1.ExternalServicePort{Port: 80, Protocol: &tcp, Mode: egressv1.PortModeHTTP})
+	for address, want := range map[string]envoyv3.Cluster_DiscoveryType{
+		"10.96.0.60:4317":                      envoyv3.Cluster_STATIC,
+		"otel-collector.example.internal:4317": envoyv3.Cluster_STRICT_DNS,
+	} {
+		t.Setenv("TRACING_OTLP_ADDRESS", address)
+		clusters, err := tracingClusters(es)
+		if err != nil {
+			t.Fatalf("tracingClusters() error = %v", err)
+		}
+		if len(clusters) != 1 {
+			t.Fatalf("tracingClusters() = %v, want the collector's cluster", clusters)
+		}
+		c := clusters[0]
+		endpoint := c.GetLoadAssignment().GetEndpoints()[0].GetLbEndpoints()[0].GetEndpoint().GetAddress().GetSocketAddress()
+		if c.Name != tracingClusterName || c.GetType() != want || net.JoinHostPort(endpoint.GetAddress(), fmt.Sprint(endpoint.GetPortValue())) != address {
+			t.Errorf("tracingClusters() with %s = %v", address, c)
+		}
+	}
+}
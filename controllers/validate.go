@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	bootstrap "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	envoyv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoylistener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	aggregatev3 "github.com/envoyproxy/go-control-plane/envoy/extensions/clusters/aggregate/v3"
+	"github.com/golang/protobuf/proto"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+// +kubebuilder:rbac:namespace=egress-operator-system,groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+
+// validationLabel labels validation Jobs, their ConfigMaps and pods with the ExternalService they validate
+const validationLabel = "egress.monzo.com/validate"
+
+// configInvalidError is a generated configuration which was rejected. Unlike other errors, retrying won't help until
+// the spec changes.
+type configInvalidError struct {
+	err error
+}
+
+func (e configInvalidError) Error() string {
+	return e.err.Error()
+}
+
+func (e configInvalidError) Unwrap() error {
+	return e.err
+}
+
+func isConfigInvalid(err error) bool {
+	var invalid configInvalidError
+	return errors.As(err, &invalid)
+}
+
+// validateBootstrap checks a bootstrap and its static resources before they are rolled out
+func validateBootstrap(config *bootstrap.Bootstrap) error {
+	if err := config.ValidateAll(); err != nil {
+		return configInvalidError{err}
+	}
+
+	adminPort := config.GetAdmin().GetAddress().GetSocketAddress().GetPortValue()
+	return validateResources(adminPort, config.GetStaticResources().GetClusters(), config.GetStaticResources().GetListeners())
+}
+
+// validateResources checks listeners and clusters against Envoy's proto constraints, and for mistakes those can't
+// catch, which Envoy would otherwise only reject when gateway pods start
+func validateResources(adminPort uint32, clusters []*envoyv3.Cluster, listeners []*envoylistener.Listener) error {
+	names := map[string]bool{}
+	for _, c := range clusters {
+		if err := c.ValidateAll(); err != nil {
+			return configInvalidError{fmt.Errorf("cluster %s: %w", c.Name, err)}
+		}
+		if names[c.Name] {
+			return configInvalidError{fmt.Errorf("cluster %s is defined more than once", c.Name)}
+		}
+		names[c.Name] = true
+	}
+
+	for _, c := range clusters {
+		if c.GetClusterType().GetName() != "envoy.clusters.aggregate" {
+			continue
+		}
+		aggregate := &aggregatev3.ClusterConfig{}
+		if err := c.GetClusterType().GetTypedConfig().UnmarshalTo(aggregate); err != nil {
+			return configInvalidError{fmt.Errorf("cluster %s: %w", c.Name, err)}
+		}
+		for _, name := range aggregate.Clusters {
+			if !names[name] {
+				return configInvalidError{fmt.Errorf("aggregate cluster %s references missing cluster %s", c.Name, name)}
+			}
+		}
+	}
+
+	// Listeners bind the wildcard address, so they clash with the admin interface on localhost too
+	bound := map[string]string{fmt.Sprintf("TCP/%d", adminPort): "the admin interface"}
+	for _, l := range listeners {
+		if err := l.ValidateAll(); err != nil {
+			return configInvalidError{fmt.Errorf("listener %s: %w", l.Name, err)}
+		}
+		address := l.GetAddress().GetSocketAddress()
+		key := fmt.Sprintf("%s/%d", address.GetProtocol(), address.GetPortValue())
+		if other, ok := bound[key]; ok {
+			return configInvalidError{fmt.Errorf("listener %s binds port %s already used by %s", l.Name, key, other)}
+		}
+		bound[key] = "listener " + l.Name
+	}
+
+	return nil
+}
+
+// validationJobName is unique to each configuration, and short enough for the job-name label Kubernetes adds to the
+// Job's pods. A truncated name mustn't end in - or ., which would make it an invalid DNS name.
+func validationJobName(es *egressv1.ExternalService, configHash string) string {
+	name := es.Name
+	if len(name) > 45 {
+		name = strings.TrimRight(name[:45], "-.")
+	}
+	return name + "-validate-" + configHash
+}
+
+// validationJob runs `envoy --mode validate` against the configuration in the ConfigMap of the same name, with the
+// gateway's TLS Secrets mounted, as Envoy also checks the files its configuration references
+func validationJob(es *egressv1.ExternalService, name string) *batchv1.Job {
+	l := map[string]string{validationLabel: es.Name}
+	volumes, mounts := tlsSecretVolumes(es)
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    l,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          proto.Int32(0),
+			ActiveDeadlineSeconds: proto.Int64(300),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: l,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:            "validate",
+							Image:           envoyImage(es),
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Args:            []string{"--mode", "validate", "-c", "/etc/envoy/envoy.yaml"},
+							VolumeMounts: append([]corev1.VolumeMount{
+								{
+									Name:      "envoy-config",
+									MountPath: "/etc/envoy",
+								},
+							}, mounts...),
+							// Envoy's reason for rejecting the configuration is surfaced on the ExternalService
+							TerminationMessagePath:   corev1.TerminationMessagePathDefault,
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+							Env: []corev1.EnvVar{
+								{
+									Name:  "ENVOY_UID",
+									Value: "0",
+								},
+							},
+						},
+					},
+					RestartPolicy: corev1.RestartPolicyNever,
+					DNSPolicy:     corev1.DNSDefault,
+					Volumes: append([]corev1.Volume{
+						{
+							Name: "envoy-config",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									DefaultMode: proto.Int32(420),
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: name,
+									},
+								},
+							},
+						},
+					}, volumes...),
+				},
+			},
+		},
+	}
+}
+
+// validateConfigWithEnvoy runs the gateway's complete configuration through its Envoy image in a Job, which catches everything
+// it would reject on startup. It returns whether the configuration passed; while the Job is running, it returns false,
+// and the ExternalService is reconciled again when the Job finishes. The Job is kept until the configuration changes
+// again, so each configuration is only validated once.
+func (r *ExternalServiceReconciler) validateConfigWithEnvoy(ctx context.Context, es *egressv1.ExternalService) (bool, error) {
+	ec, err := envoyConfig(es)
+	if err != nil {
+		return false, err
+	}
+	// A new image is validated too, as it may not support the same configuration
+	name := validationJobName(es, configHash(envoyImage(es)+"\n"+ec))
+
+	job := &batchv1.Job{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, job); err != nil {
+		if apierrs.IsNotFound(err) {
+			return false, r.startValidation(ctx, es, name, ec)
+		}
+		return false, err
+	}
+
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return true, nil
+		case batchv1.JobFailed:
+			pods, err := r.jobPods(ctx, job)
+			if err != nil {
+				return false, err
+			}
+			message, rejected := validationFailure(c, pods)
+			if rejected {
+				return false, configInvalidError{fmt.Errorf("envoy rejected the configuration: %s", message)}
+			}
+			// Envoy never got to check the configuration, so it's validated again by a new Job
+			if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); ignoreNotFound(err) != nil {
+				return false, err
+			}
+			return false, fmt.Errorf("validation Job %s failed: %s", job.Name, message)
+		}
+	}
+
+	// The Job is created first, so its ConfigMap may be missing if creating it failed
+	return false, r.ensureValidationConfigMap(ctx, job, ec)
+}
+
+// startValidation replaces any Jobs validating previous configurations with one for ec
+func (r *ExternalServiceReconciler) startValidation(ctx context.Context, es *egressv1.ExternalService, name, ec string) error {
+	jobs := &batchv1.JobList{}
+	if err := r.List(ctx, jobs, client.InNamespace(namespace), client.MatchingLabels{validationLabel: es.Name}); err != nil {
+		return err
+	}
+	for i := range jobs.Items {
+		if jobs.Items[i].Name == name {
+			continue
+		}
+		if err := r.Delete(ctx, &jobs.Items[i], client.PropagationPolicy(metav1.DeletePropagationBackground)); ignoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	job := validationJob(es, name)
+	if err := applyPodLevelOverlays(es, r.DefaultPodTemplateOverlay, &job.Spec.Template); err != nil {
+		return err
+	}
+	if err := ctrl.SetControllerReference(es, job, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Create(ctx, job); err != nil {
+		return err
+	}
+
+	return r.ensureValidationConfigMap(ctx, job, ec)
+}
+
+// ensureValidationConfigMap creates the ConfigMap holding the configuration a validation Job checks. It's owned by the
+// Job, so it's deleted along with it. The Job's pod waits for it to be created.
+func (r *ExternalServiceReconciler) ensureValidationConfigMap(ctx context.Context, job *batchv1.Job, ec string) error {
+	cm := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: job.Name}, cm)
+	if !apierrs.IsNotFound(err) {
+		return err
+	}
+
+	cm = &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Name,
+			Namespace: namespace,
+			Labels:    job.Labels,
+		},
+		Data: map[string]string{"envoy.yaml": ec},
+	}
+	if err := ctrl.SetControllerReference(job, cm, r.Scheme); err != nil {
+		return err
+	}
+
+	return r.Create(ctx, cm)
+}
+
+func (r *ExternalServiceReconciler) jobPods(ctx context.Context, job *batchv1.Job) ([]corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// validationFailure explains why a validation Job failed, and whether it's because Envoy rejected the configuration.
+// Otherwise, such as if the image couldn't be pulled or the Job ran out of time, Envoy never checked it.
+func validationFailure(failed batchv1.JobCondition, pods []corev1.Pod) (string, bool) {
+	if failed.Reason == batchv1.JobReasonDeadlineExceeded {
+		return failed.Message, false
+	}
+
+	for _, pod := range pods {
+		for _, status := range pod.Status.ContainerStatuses {
+			// Exit codes from 128 are signals, such as being OOM killed
+			if t := status.State.Terminated; t != nil && t.ExitCode != 0 {
+				if t.ExitCode >= 128 {
+					return fmt.Sprintf("envoy was killed: %s", t.Reason), false
+				}
+				if t.Message == "" {
+					return fmt.Sprintf("envoy exited with code %d", t.ExitCode), true
+				}
+				return strings.TrimSpace(t.Message), true
+			}
+			if w := status.State.Waiting; w != nil && w.Reason != "" {
+				return fmt.Sprintf("%s: %s", w.Reason, w.Message), false
+			}
+		}
+	}
+
+	return failed.Message, false
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	envoyv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoylistener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+func Test_validateResources(t *testing.T) {
+	tcp := corev1.ProtocolTCP
+	es := &egressv1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+		Spec: egressv1.ExternalServiceSpec{
+			DnsName: "example.com",
+			Ports:   []egressv1.ExternalServicePort{{Port: 443, Protocol: &tcp}},
+		},
+	}
+	clusters, listeners, err := envoyResources(es)
+	if err != nil {
+		t.Fatalf("envoyResources() error = %v", err)
+	}
+
+	if err := validateResources(uint32(adminPort(es)), clusters, listeners); err != nil {
+		t.Errorf("validateResources() error = %v", err)
+	}
+
+	aggregate, err := generateAggregateCluster("foo_TCP_443-aggregate", "foo_TCP_443", "foo_TCP_443-override")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		adminPort uint32
+		clusters  []*envoyv3.Cluster
+		listeners []*envoylistener.Listener
+		wantErr   string
+	}{
+		{
+			name:      "admin port clash",
+			adminPort: 443,
+			clusters:  clusters,
+			listeners: listeners,
+			wantErr:   "listener foo_TCP_443 binds port TCP/443 already used by the admin interface",
+		},
+		{
+			name:      "listener port clash",
+			adminPort: uint32(adminPort(es)),
+			clusters:  clusters,
+			listeners: append([]*envoylistener.Listener{listeners[0]}, listeners...),
+			wantErr:   "listener foo_TCP_443 binds port TCP/443 already used by listener foo_TCP_443",
+		},
+		{
+			name:      "missing aggregated cluster",
+			adminPort: uint32(adminPort(es)),
+			clusters:  append(clusters, aggregate),
+			listeners: listeners,
+			wantErr:   "aggregate cluster foo_TCP_443-aggregate references missing cluster foo_TCP_443-override",
+		},
+		{
+			name:      "duplicate cluster",
+			adminPort: uint32(adminPort(es)),
+			clusters:  append(clusters, clusters[0]),
+			listeners: listeners,
+			wantErr:   "cluster foo_TCP_443 is defined more than once",
+		},
+		{
+			name:      "proto constraint",
+			adminPort: uint32(adminPort(es)),
+			clusters:  []*envoyv3.Cluster{{}},
+			listeners: listeners,
+			wantErr:   "cluster : invalid Cluster.Name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateResources(tt.adminPort, tt.clusters, tt.listeners)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("validateResources() error = %v, want %v", err, tt.wantErr)
+			}
+			if !isConfigInvalid(err) {
+				t.Errorf("validateResources() error = %v, want a configInvalidError", err)
+			}
+		})
+	}
+}
+
+func Test_validationJobName(t *testing.T) {
+	for _, name := range []string{
+		strings.Repeat("a", 63),
+		strings.Repeat("a", 44) + ".b" + strings.Repeat("c", 10),
+		strings.Repeat("a", 43) + "-.-" + strings.Repeat("c", 10),
+	} {
+		es := &egressv1.ExternalService{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		got := validationJobName(es, "deadbeef")
+		if errs := validation.IsDNS1123Subdomain(got); len(errs) > 0 {
+			t.Errorf("validationJobName(%s) = %v, not a valid name: %v", name, got, errs)
+		}
+		if errs := validation.IsValidLabelValue(got); len(errs) > 0 {
+			t.Errorf("validationJobName(%s) = %v, not a valid label value: %v", name, got, errs)
+		}
+	}
+}
+
+func Test_validationJob(t *testing.T) {
+	es := &egressv1.ExternalService{ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("a", 63)}}
+
+	name := validationJobName(es, "deadbeef")
+	if len(name) > 63 {
+		t.Errorf("validationJobName() = %v, longer than a label value", name)
+	}
+
+	job := validationJob(es, name)
+	spec := job.Spec.Template.Spec
+	if got := spec.Volumes[0].ConfigMap.Name; got != name {
+		t.Errorf("validationJob() config volume = %v, want %v", got, name)
+	}
+	if got := strings.Join(spec.Containers[0].Args, " "); got != "--mode validate -c /etc/envoy/envoy.yaml" {
+		t.Errorf("validationJob() args = %v", got)
+	}
+	if got := job.Labels[validationLabel]; got != es.Name {
+		t.Errorf("validationJob() label = %v, want %v", got, es.Name)
+	}
+}
+
+func Test_validationFailure(t *testing.T) {
+	failed := batchv1.JobCondition{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: batchv1.JobReasonBackoffLimitExceeded, Message: "Job has reached the specified backoff limit"}
+	pod := func(state corev1.ContainerState) []corev1.Pod {
+		return []corev1.Pod{{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: "validate", State: state}}}}}
+	}
+
+	tests := []struct {
+		name         string
+		failed       batchv1.JobCondition
+		pods         []corev1.Pod
+		wantMessage  string
+		wantRejected bool
+	}{
+		{
+			name:         "rejected",
+			failed:       failed,
+			pods:         pod(corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Message: "error initializing configuration\n"}}),
+			wantMessage:  "error initializing configuration",
+			wantRejected: true,
+		},
+		{
+			name:        "image pull",
+			failed:      failed,
+			pods:        pod(corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}}),
+			wantMessage: "ImagePullBackOff: Back-off pulling image",
+		},
+		{
+			name:        "killed",
+			failed:      failed,
+			pods:        pod(corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}}),
+			wantMessage: "envoy was killed: OOMKilled",
+		},
+		{
+			name:        "deadline",
+			failed:      batchv1.JobCondition{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: batchv1.JobReasonDeadlineExceeded, Message: "Job was active longer than specified deadline"},
+			pods:        pod(corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}}),
+			wantMessage: "Job was active longer than specified deadline",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, rejected := validationFailure(tt.failed, tt.pods)
+			if message != tt.wantMessage || rejected != tt.wantRejected {
+				t.Errorf("validationFailure() = %q, %v, want %q, %v", message, rejected, tt.wantMessage, tt.wantRejected)
+			}
+		})
+	}
+}
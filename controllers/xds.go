@@ -0,0 +1,284 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	bootstrap "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	envoyv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoycorev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoyendpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	httpv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+	clusterservice "github.com/envoyproxy/go-control-plane/envoy/service/cluster/v3"
+	discoverygrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	listenerservice "github.com/envoyproxy/go-control-plane/envoy/service/listener/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	cachev3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	xdslog "github.com/envoyproxy/go-control-plane/pkg/log"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	serverv3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+// xdsClusterName is the bootstrap cluster gateways reach the xDS server through
+const xdsClusterName = "xds_cluster"
+
+// xdsRolloutRecheckInterval is how often a push held back for a Deployment to mount new Secrets is retried
+const xdsRolloutRecheckInterval = 10 * time.Second
+
+// XdsServer is an embedded xDS management server. Gateways bootstrap with only their admin interface and a cluster
+// pointing at it, then receive their listeners and clusters over ADS, so spec changes are applied without restarting
+// them.
+// +kubebuilder:object:generate=false
+type XdsServer struct {
+	// BindAddress is where the gRPC server listens, such as :18000
+	BindAddress string
+	// Address is the host:port gateways connect to. Gateway pods use the node's DNS resolver, so it should be an IP
+	// or a name the node can resolve, such as the ClusterIP of a Service in front of the operator.
+	Address string
+
+	Log     logr.Logger
+	cache   cachev3.SnapshotCache
+	serving atomic.Bool
+}
+
+// gatewayHash identifies gateways by their node cluster, which is the ExternalService name, so every replica of a
+// gateway shares a snapshot
+type gatewayHash struct{}
+
+func (gatewayHash) ID(node *envoycorev3.Node) string {
+	return node.GetCluster()
+}
+
+// NewXdsServer creates an xDS server with an empty snapshot cache, logging through log
+func NewXdsServer(bindAddress, address string, log logr.Logger) *XdsServer {
+	logf := func(level int) func(string, ...interface{}) {
+		return func(format string, args ...interface{}) {
+			log.V(level).Info(fmt.Sprintf(format, args...))
+		}
+	}
+
+	return &XdsServer{
+		BindAddress: bindAddress,
+		Address:     address,
+		Log:         log,
+		cache: cachev3.NewSnapshotCache(true, gatewayHash{}, xdslog.LoggerFuncs{
+			DebugFunc: logf(1),
+			InfoFunc:  logf(0),
+			WarnFunc:  logf(0),
+			ErrorFunc: func(format string, args ...interface{}) {
+				log.Error(fmt.Errorf(format, args...), "xDS error")
+			},
+		}),
+	}
+}
+
+// Start serves xDS until ctx is done. It implements manager.Runnable, so the server only runs on the leader, which
+// is the only replica reconciling ExternalServices.
+func (s *XdsServer) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.BindAddress)
+	if err != nil {
+		return err
+	}
+
+	grpcServer := grpc.NewServer()
+	xds := serverv3.NewServer(ctx, s.cache, nil)
+	discoverygrpc.RegisterAggregatedDiscoveryServiceServer(grpcServer, xds)
+	clusterservice.RegisterClusterDiscoveryServiceServer(grpcServer, xds)
+	listenerservice.RegisterListenerDiscoveryServiceServer(grpcServer, xds)
+
+	go func() {
+		<-ctx.Done()
+		grpcServer.GracefulStop()
+	}()
+
+	s.Log.Info("serving xDS", "address", s.BindAddress)
+	s.serving.Store(true)
+	defer s.serving.Store(false)
+	return grpcServer.Serve(listener)
+}
+
+// Ready is a readiness check passing while the server is serving, so a Service in front of the operator only sends
+// gateways to the leader
+func (s *XdsServer) Ready(_ *http.Request) error {
+	if !s.serving.Load() {
+		return errors.New("not serving xDS, as this replica isn't the leader")
+	}
+	return nil
+}
+
+// setResources pushes an ExternalService's listeners and clusters to its gateways. The version is a hash of the
+// resources, so reconciling an unchanged ExternalService doesn't push anything.
+func (s *XdsServer) setResources(ctx context.Context, es *egressv1.ExternalService) error {
+	snapshot, err := xdsSnapshot(es)
+	if err != nil {
+		return err
+	}
+
+	return s.cache.SetSnapshot(ctx, es.Name, snapshot)
+}
+
+// xdsSnapshot generates and validates an ExternalService's listeners and clusters
+func xdsSnapshot(es *egressv1.ExternalService) (*cachev3.Snapshot, error) {
+	clusters, listeners, err := envoyResources(es)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateResources(uint32(adminPort(es)), clusters, listeners); err != nil {
+		return nil, err
+	}
+
+	resources := map[resource.Type][]types.Resource{}
+	h := fnv.New32a()
+	for _, c := range clusters {
+		resources[resource.ClusterType] = append(resources[resource.ClusterType], c)
+		if err := hashResource(h, c); err != nil {
+			return nil, err
+		}
+	}
+	for _, l := range listeners {
+		resources[resource.ListenerType] = append(resources[resource.ListenerType], l)
+		if err := hashResource(h, l); err != nil {
+			return nil, err
+		}
+	}
+
+	snapshot, err := cachev3.NewSnapshot(fmt.Sprintf("%x", h.Sum32()), resources)
+	if err != nil {
+		return nil, err
+	}
+	if err := snapshot.Consistent(); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// clearResources forgets a deleted ExternalService's snapshot
+func (s *XdsServer) clearResources(name string) {
+	s.cache.ClearSnapshot(name)
+}
+
+func hashResource(h hash.Hash, m proto.Message) error {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = h.Write(b)
+	return err
+}
+
+// generateGrpcCluster is a cluster for the gRPC service at address, such as the xDS server or a telemetry collector,
+// over HTTP/2. Gateway pods use the node's DNS resolver, so address must be an IP or a name the node can resolve.
+func generateGrpcCluster(name, address string) (*envoyv3.Cluster, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	discoveryType := envoyv3.Cluster_STRICT_DNS
+	if net.ParseIP(host) != nil {
+		discoveryType = envoyv3.Cluster_STATIC
+	}
+
+	protocolOptions, err := anypb.New(&httpv3.HttpProtocolOptions{
+		UpstreamProtocolOptions: &httpv3.HttpProtocolOptions_ExplicitHttpConfig_{
+			ExplicitHttpConfig: &httpv3.HttpProtocolOptions_ExplicitHttpConfig{
+				ProtocolConfig: &httpv3.HttpProtocolOptions_ExplicitHttpConfig_Http2ProtocolOptions{
+					Http2ProtocolOptions: &envoycorev3.Http2ProtocolOptions{},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoyv3.Cluster{
+		Name:                 name,
+		ClusterDiscoveryType: &envoyv3.Cluster_Type{Type: discoveryType},
+		ConnectTimeout:       connectTimeout(egressv1.ConnectionSettings{}),
+		TypedExtensionProtocolOptions: map[string]*anypb.Any{
+			"envoy.extensions.upstreams.http.v3.HttpProtocolOptions": protocolOptions,
+		},
+		LoadAssignment: &envoyendpoint.ClusterLoadAssignment{
+			ClusterName: name,
+			Endpoints: []*envoyendpoint.LocalityLbEndpoints{{
+				LbEndpoints: []*envoyendpoint.LbEndpoint{{
+					HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{
+						Endpoint: &envoyendpoint.Endpoint{
+							Address: &envoycorev3.Address{
+								Address: &envoycorev3.Address_SocketAddress{
+									SocketAddress: &envoycorev3.SocketAddress{
+										Address:  host,
+										Protocol: envoycorev3.SocketAddress_TCP,
+										PortSpecifier: &envoycorev3.SocketAddress_PortValue{
+											PortValue: uint32(port),
+										},
+									},
+								},
+							},
+						},
+					},
+				}},
+			}},
+		},
+	}, nil
+}
+
+// xdsEnvoyConfig is a gateway's bootstrap when its listeners and clusters come from the xDS server at address
+func xdsEnvoyConfig(es *egressv1.ExternalService, address string) (string, error) {
+	config, err := envoyBootstrap(es)
+	if err != nil {
+		return "", err
+	}
+
+	// xDS is gRPC, and this is the bootstrap cluster gateways fetch their configuration from
+	xdsCluster, err := generateGrpcCluster(xdsClusterName, address)
+	if err != nil {
+		return "", err
+	}
+	// Envoy needs a node ID to subscribe. Replicas share it, as they share their configuration.
+	config.Node.Id = es.Name
+	config.StaticResources.Clusters = []*envoyv3.Cluster{xdsCluster}
+
+	ads := &envoycorev3.ConfigSource{
+		ResourceApiVersion:    envoycorev3.ApiVersion_V3,
+		ConfigSourceSpecifier: &envoycorev3.ConfigSource_Ads{Ads: &envoycorev3.AggregatedConfigSource{}},
+	}
+	config.DynamicResources = &bootstrap.Bootstrap_DynamicResources{
+		AdsConfig: &envoycorev3.ApiConfigSource{
+			ApiType:             envoycorev3.ApiConfigSource_GRPC,
+			TransportApiVersion: envoycorev3.ApiVersion_V3,
+			GrpcServices: []*envoycorev3.GrpcService{{
+				TargetSpecifier: &envoycorev3.GrpcService_EnvoyGrpc_{
+					EnvoyGrpc: &envoycorev3.GrpcService_EnvoyGrpc{ClusterName: xdsClusterName},
+				},
+			}},
+		},
+		CdsConfig: ads,
+		LdsConfig: ads,
+	}
+	if err := validateBootstrap(config); err != nil {
+		return "", err
+	}
+
+	return marshalBootstrap(config)
+}
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	envoyv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	egressv1 "github.com/monzo/egress-operator/api/v1"
+)
+
+func xdsExternalService() *egressv1.ExternalService {
+	tcp := corev1.ProtocolTCP
+	return &egressv1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"},
+		Spec: egressv1.ExternalServiceSpec{
+			DnsName: "example.com",
+			Ports:   []egressv1.ExternalServicePort{{Port: 443, Protocol: &tcp}},
+		},
+	}
+}
+
+func Test_xdsEnvoyConfig(t *testing.T) {
+	got, err := xdsEnvoyConfig(xdsExternalService(), "10.96.0.100:18000")
+	if err != nil {
+		t.Fatalf("xdsEnvoyConfig() error = %v", err)
+	}
+
+	want := `admin:
+  accessLog:
+  - name: envoy.stdout_access_log
+    typedConfig:
+      '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+      logFormat:
+        contentType: application/json; charset=UTF-8
+        omitEmptyValues: true
+        textFormatSource:
+          inlineString: |
+            [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+  address:
+    socketAddress:
+      address: 127.0.0.1
+      portValue: 11000
+dynamicResources:
+  adsConfig:
+    apiType: GRPC
+    grpcServices:
+    - envoyGrpc:
+        clusterName: xds_cluster
+    transportApiVersion: V3
+  cdsConfig:
+    ads: {}
+    resourceApiVersion: V3
+  ldsConfig:
+    ads: {}
+    resourceApiVersion: V3
+node:
+  cluster: foo
+  id: foo
+staticResources:
+  clusters:
+  - connectTimeout: 1s
+    loadAssignment:
+      clusterName: xds_cluster
+      endpoints:
+      - lbEndpoints:
+        - endpoint:
+            address:
+              socketAddress:
+                address: 10.96.0.100
+                portValue: 18000
+    name: xds_cluster
+    type: STATIC
+    typedExtensionProtocolOptions:
+      envoy.extensions.upstreams.http.v3.HttpProtocolOptions:
+        '@type': type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions
+        explicitHttpConfig:
+          http2ProtocolOptions: {}
+`
+	if got != want {
+		t.Errorf("xdsEnvoyConfig() got = %v, want %v", got, want)
+	}
+
+	if _, err := xdsEnvoyConfig(xdsExternalService(), "xds.egress-operator-system"); err == nil {
+		t.Errorf("xdsEnvoyConfig() without a port expected an error")
+	}
+}
+
+func Test_generateGrpcCluster(t *testing.T) {
+	for address, want := range map[string]envoyv3.Cluster_DiscoveryType{
+		"10.96.0.100:18000":          envoyv3.Cluster_STATIC,
+		"[fd00::1]:18000":            envoyv3.Cluster_STATIC,
+		"xds.example.internal:18000": envoyv3.Cluster_STRICT_DNS,
+	} {
+		cluster, err := generateGrpcCluster(xdsClusterName, address)
+		if err != nil {
+			t.Fatalf("generateGrpcCluster(%s) error = %v", address, err)
+		}
+		if got := cluster.GetType(); got != want {
+			t.Errorf("generateGrpcCluster(%s) type = %v, want %v", address, got, want)
+		}
+	}
+}
+
+func Test_XdsServer_setResources(t *testing.T) {
+	ctx := context.Background()
+	s := NewXdsServer(":18000", "10.96.0.100:18000", logr.Discard())
+	es := xdsExternalService()
+
+	if err := s.setResources(ctx, es); err != nil {
+		t.Fatalf("setResources() error = %v", err)
+	}
+	snapshot, err := s.cache.GetSnapshot("foo")
+	if err != nil {
+		t.Fatalf("GetSnapshot() error = %v", err)
+	}
+	version := snapshot.GetVersion(resource.ClusterType)
+	if got := len(snapshot.GetResources(resource.ListenerType)); got != 2 {
+		t.Errorf("setResources() listeners = %v, want 2", got)
+	}
+
+	if err := s.setResources(ctx, es); err != nil {
+		t.Fatalf("setResources() error = %v", err)
+	}
+	snapshot, _ = s.cache.GetSnapshot("foo")
+	if got := snapshot.GetVersion(resource.ClusterType); got != version {
+		t.Errorf("setResources() of an unchanged ExternalService changed version from %v to %v", version, got)
+	}
+
+	es.Spec.Ports[0].Port = 8443
+	if err := s.setResources(ctx, es); err != nil {
+		t.Fatalf("setResources() error = %v", err)
+	}
+	snapshot, _ = s.cache.GetSnapshot("foo")
+	if got := snapshot.GetVersion(resource.ClusterType); got == version {
+		t.Errorf("setResources() of a changed ExternalService kept version %v", version)
+	}
+
+	s.clearResources("foo")
+	if _, err := s.cache.GetSnapshot("foo"); err == nil {
+		t.Errorf("clearResources() kept the snapshot")
+	}
+}
+
+func Test_podsMountSecrets(t *testing.T) {
+	pod := func(secrets ...string) corev1.Pod {
+		p := corev1.Pod{}
+		for _, s := range secrets {
+			p.Spec.Volumes = append(p.Spec.Volumes, corev1.Volume{VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: s}}})
+		}
+		return p
+	}
+	terminating := pod()
+	terminating.DeletionTimestamp = &metav1.Time{}
+
+	tests := []struct {
+		name string
+		pods []corev1.Pod
+		want bool
+	}{
+		{name: "no pods", want: true},
+		{name: "all mounted", pods: []corev1.Pod{pod("ca", "client"), pod("client", "ca")}, want: true},
+		{name: "old pod", pods: []corev1.Pod{pod("ca", "client"), pod("ca")}, want: false},
+		{name: "old pod shutting down", pods: []corev1.Pod{pod("ca", "client"), terminating}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := podsMountSecrets(tt.pods, []string{"ca", "client"}); got != tt.want {
+				t.Errorf("podsMountSecrets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package egressoperator
 import (
 	"fmt"
 	"regexp"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/coredns/coredns/plugin"
@@ -42,31 +44,89 @@ func newdnsController(kubeClient kubernetes.Interface, namespace, zone string, r
 			close(dns.ready)
 		})
 
-		rules := make([]rewrite.Rule, 0, len(is))
-
+		services := make([]*api.Service, 0, len(is))
 		for _, i := range is {
 			svc := i.(*api.Service)
 			if svc == nil {
 				continue
 			}
+			services = append(services, svc)
+		}
 
-			from, ok := svc.Annotations["egress.monzo.com/dns-name"]
-			if !ok {
-				log.Warningf("%s is missing dns-name annotation", svc.Name)
-				continue
-			}
+		rulesCallback(buildRules(services, zone))
+	}, cache.MetaNamespaceKeyFunc)
+
+	s := labels.SelectorFromSet(map[string]string{
+		"app":                         "egress-gateway",
+		"egress.monzo.com/hijack-dns": "true",
+	})
+
+	dns.reflector = cache.NewReflector(&cache.ListWatch{
+		ListFunc:  serviceListFunc(kubeClient, namespace, s),
+		WatchFunc: serviceWatchFunc(kubeClient, namespace, s),
+	}, &api.Service{}, store, 0)
+
+	return dns
+}
+
+// buildRules returns the rewrite rules for the gateway Services, in the order they're tried
+func buildRules(services []*api.Service, zone string) []rewrite.Rule {
+	// If several gateways claim the same name, the oldest one wins. The operator stops hijacking for
+	// conflicting ExternalServices, but we can't rely on seeing that update before the conflicting Service.
+	sort.Slice(services, func(i, j int) bool {
+		ci, cj := services[i].CreationTimestamp, services[j].CreationTimestamp
+		if !ci.Equal(&cj) {
+			return ci.Before(&cj)
+		}
+		return services[i].Name < services[j].Name
+	})
+
+	owners := map[string]string{}
+
+	// Exact names are matched before wildcards, and more specific wildcards before less specific ones
+	var exactRules []rewrite.Rule
+	var suffixRules []*suffixNameRule
+
+	for _, svc := range services {
+		names := dnsNames(svc)
+		if len(names) == 0 {
+			log.Warningf("%s is missing dns-name annotation", svc.Name)
+			continue
+		}
 
-			to := fmt.Sprintf("%s.%s.svc.%s", svc.Name, svc.Namespace, zone)
+		var families ipFamilies
+		if f := svc.Annotations["egress.monzo.com/ip-families"]; f != "" {
+			families = strings.Split(f, ",")
+		}
+
+		to := fmt.Sprintf("%s.%s.svc.%s", svc.Name, svc.Namespace, zone)
+		rewriteQuestionTo := plugin.Name(to).Normalize()
 
+		for _, from := range names {
 			rewriteQuestionFrom := plugin.Name(from).Normalize()
-			rewriteQuestionTo := plugin.Name(to).Normalize()
+
+			if owner, ok := owners[rewriteQuestionFrom]; ok {
+				log.Warningf("%s claims dns-name %s which is already served by %s, ignoring", svc.Name, from, owner)
+				continue
+			}
+			owners[rewriteQuestionFrom] = svc.Name
+
+			if strings.HasPrefix(rewriteQuestionFrom, "*.") {
+				suffixRules = append(suffixRules, &suffixNameRule{
+					NextAction: "stop",
+					Suffix:     strings.TrimPrefix(rewriteQuestionFrom, "*"),
+					To:         rewriteQuestionTo,
+					ipFamilies: families,
+				})
+				continue
+			}
 
 			rewriteAnswerFromPattern, err := regexp.Compile(rewriteQuestionTo)
 			if err != nil {
 				continue
 			}
 
-			rules = append(rules, &exactNameRule{
+			exactRules = append(exactRules, &exactNameRule{
 				NextAction: "stop",
 				From:       rewriteQuestionFrom,
 				To:         rewriteQuestionTo,
@@ -76,23 +136,36 @@ func newdnsController(kubeClient kubernetes.Interface, namespace, zone string, r
 					Pattern:     rewriteAnswerFromPattern,
 					Replacement: rewriteQuestionFrom,
 				},
+				ipFamilies: families,
 			})
 		}
+	}
 
-		rulesCallback(rules)
-	}, cache.MetaNamespaceKeyFunc)
-
-	s := labels.SelectorFromSet(map[string]string{
-		"app":                         "egress-gateway",
-		"egress.monzo.com/hijack-dns": "true",
+	sort.SliceStable(suffixRules, func(i, j int) bool {
+		return len(suffixRules[i].Suffix) > len(suffixRules[j].Suffix)
 	})
 
-	dns.reflector = cache.NewReflector(&cache.ListWatch{
-		ListFunc:  serviceListFunc(kubeClient, namespace, s),
-		WatchFunc: serviceWatchFunc(kubeClient, namespace, s),
-	}, &api.Service{}, store, 0)
+	rules := make([]rewrite.Rule, 0, len(exactRules)+len(suffixRules))
+	rules = append(rules, exactRules...)
+	for _, rule := range suffixRules {
+		rules = append(rules, rule)
+	}
 
-	return dns
+	return rules
+}
+
+// dnsNames returns every name a gateway Service should receive queries for. Gateways with aliases list all
+// of their names in dns-names, otherwise there is just the dns-name.
+func dnsNames(svc *api.Service) []string {
+	if names, ok := svc.Annotations["egress.monzo.com/dns-names"]; ok && names != "" {
+		return strings.Split(names, ",")
+	}
+
+	if name, ok := svc.Annotations["egress.monzo.com/dns-name"]; ok {
+		return []string{name}
+	}
+
+	return nil
 }
 
 func serviceListFunc(c kubernetes.Interface, ns string, s labels.Selector) func(meta.ListOptions) (runtime.Object, error) {
@@ -0,0 +1,110 @@
+package egressoperator
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+)
+
+// ruleNames describes rules by the name or suffix they match, in order
+func ruleNames(t *testing.T, services []*api.Service) []string {
+	t.Helper()
+
+	var names []string
+	for _, rule := range buildRules(services, "cluster.local") {
+		switch r := rule.(type) {
+		case *exactNameRule:
+			names = append(names, r.From+" -> "+r.To)
+		case *suffixNameRule:
+			names = append(names, "*"+r.Suffix+" -> "+r.To)
+		default:
+			t.Fatalf("buildRules() returned an unexpected rule %T", rule)
+		}
+	}
+	return names
+}
+
+func Test_buildRules_order(t *testing.T) {
+	services := []*api.Service{
+		gatewayService("wildcard", 1, map[string]string{"egress.monzo.com/dns-name": "*.example.com"}),
+		gatewayService("s3", 2, map[string]string{"egress.monzo.com/dns-name": "*.s3.example.com"}),
+		gatewayService("api", 3, map[string]string{"egress.monzo.com/dns-name": "API.example.com"}),
+		gatewayService("other", 4, map[string]string{"egress.monzo.com/dns-name": "*.example.org"}),
+	}
+
+	// Exact names come first, then wildcards from the longest suffix down
+	want := []string{
+		"api.example.com. -> " + gatewayName("api"),
+		"*.s3.example.com. -> " + gatewayName("s3"),
+		"*.example.com. -> " + gatewayName("wildcard"),
+		"*.example.org. -> " + gatewayName("other"),
+	}
+	if got := ruleNames(t, services); !reflect.DeepEqual(got, want) {
+		t.Errorf("buildRules() = %v, want %v", got, want)
+	}
+}
+
+func Test_dnsNames(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        []string
+	}{
+		{
+			name:        "dns-names",
+			annotations: map[string]string{"egress.monzo.com/dns-names": "example.com,www.example.com"},
+			want:        []string{"example.com", "www.example.com"},
+		},
+		{
+			name:        "dns-name",
+			annotations: map[string]string{"egress.monzo.com/dns-name": "example.com"},
+			want:        []string{"example.com"},
+		},
+		{
+			name: "dns-names takes precedence",
+			annotations: map[string]string{
+				"egress.monzo.com/dns-names": "example.com,www.example.com",
+				"egress.monzo.com/dns-name":  "example.org",
+			},
+			want: []string{"example.com", "www.example.com"},
+		},
+		{
+			name: "empty dns-names falls back",
+			annotations: map[string]string{
+				"egress.monzo.com/dns-names": "",
+				"egress.monzo.com/dns-name":  "example.org",
+			},
+			want: []string{"example.org"},
+		},
+		{
+			name:        "unannotated",
+			annotations: nil,
+			want:        nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dnsNames(gatewayService("gateway", 1, tt.annotations)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dnsNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_buildRules_owners(t *testing.T) {
+	services := []*api.Service{
+		// Listed newest first, to check the oldest Service still owns a name they both claim
+		gatewayService("newer", 2, map[string]string{"egress.monzo.com/dns-names": "www.example.com,example.org"}),
+		gatewayService("older", 1, map[string]string{"egress.monzo.com/dns-names": "example.com,www.example.com"}),
+	}
+
+	want := []string{
+		"example.com. -> " + gatewayName("older"),
+		"www.example.com. -> " + gatewayName("older"),
+		"example.org. -> " + gatewayName("newer"),
+	}
+	if got := ruleNames(t, services); !reflect.DeepEqual(got, want) {
+		t.Errorf("buildRules() = %v, want %v", got, want)
+	}
+}
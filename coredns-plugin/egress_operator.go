@@ -2,9 +2,12 @@ package egressoperator
 
 import (
 	"context"
+	"fmt"
 	"sync"
 
+	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/rewrite"
+	"github.com/coredns/coredns/request"
 	"github.com/miekg/dns"
 )
 
@@ -19,7 +22,52 @@ type EgressOperator struct {
 func (e *EgressOperator) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
 	e.RLock()
 	defer e.RUnlock()
-	return e.Rewrite.ServeDNS(ctx, w, r)
+
+	wr := rewrite.NewResponseReverter(w, r)
+	state := request.Request{W: w, Req: r}
+	queried := state.Name()
+
+	for _, rule := range e.Rules {
+		if rule.Rewrite(ctx, state) != rewrite.RewriteDone {
+			continue
+		}
+
+		if _, ok := dns.IsDomainName(state.Req.Question[0].Name); !ok {
+			err := fmt.Errorf("invalid name after rewrite: %s", state.Req.Question[0].Name)
+			state.Req.Question[0].Name = queried
+			return dns.RcodeServerFailure, err
+		}
+
+		// Answer queries for a family the gateway doesn't have with no records, rather than letting the
+		// client fall back to an address that bypasses the gateway
+		if f, ok := rule.(addressFamilyRule); ok && !f.servesType(state.QType()) {
+			state.Req.Question[0].Name = queried
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.Authoritative = true
+			if err := w.WriteMsg(m); err != nil {
+				return dns.RcodeServerFailure, err
+			}
+			return dns.RcodeSuccess, nil
+		}
+
+		respRule := rule.GetResponseRule()
+		if r, ok := rule.(responseRuleForName); ok {
+			respRule = r.responseRule(queried)
+		}
+		if respRule.Active {
+			wr.ResponseRewrite = true
+			wr.ResponseRules = append(wr.ResponseRules, respRule)
+		}
+		if rule.Mode() == rewrite.Stop {
+			break
+		}
+	}
+
+	if len(wr.ResponseRules) == 0 {
+		return plugin.NextOrFailure(e.Name(), e.Next, ctx, w, r)
+	}
+	return plugin.NextOrFailure(e.Name(), e.Next, ctx, wr, r)
 }
 
 // Name implements the Handler interface.
@@ -0,0 +1,179 @@
+package egressoperator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/rewrite"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	api "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// gatewayService is a gateway Service as the operator creates it, created at the given second
+func gatewayService(name string, created int64, annotations map[string]string) *api.Service {
+	return &api.Service{
+		ObjectMeta: meta.ObjectMeta{
+			Name:              name,
+			Namespace:         "egress-operator-system",
+			CreationTimestamp: meta.NewTime(time.Unix(created, 0)),
+			Annotations:       annotations,
+		},
+	}
+}
+
+func gatewayName(name string) string {
+	return name + ".egress-operator-system.svc.cluster.local."
+}
+
+// serve queries the plugin for name. It returns the name the next plugin was asked for, or "" if the plugin answered
+// itself, and the reply the client got.
+func serve(t *testing.T, services []*api.Service, name string, qtype uint16) (string, *dns.Msg) {
+	t.Helper()
+
+	var asked string
+	next := plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		asked = r.Question[0].Name
+		m := new(dns.Msg)
+		m.SetReply(r)
+		switch r.Question[0].Qtype {
+		case dns.TypeA:
+			m.Answer = append(m.Answer, test.A(asked+" 30 IN A 10.96.0.10"))
+		case dns.TypeAAAA:
+			m.Answer = append(m.Answer, test.AAAA(asked+" 30 IN AAAA fd00::10"))
+		}
+		return dns.RcodeSuccess, w.WriteMsg(m)
+	})
+
+	e := &EgressOperator{Rewrite: rewrite.Rewrite{Next: next}}
+	e.setRules(buildRules(services, "cluster.local"))
+
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(name), qtype)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := e.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatalf("ServeDNS(%s) error = %v", name, err)
+	}
+
+	return asked, rec.Msg
+}
+
+func TestServeDNS_wildcards(t *testing.T) {
+	services := []*api.Service{
+		gatewayService("wildcard", 1, map[string]string{"egress.monzo.com/dns-name": "*.example.com"}),
+		gatewayService("s3", 2, map[string]string{"egress.monzo.com/dns-name": "*.s3.example.com"}),
+		gatewayService("api", 3, map[string]string{"egress.monzo.com/dns-name": "api.example.com"}),
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "api.example.com", want: gatewayName("api")},
+		{name: "www.example.com", want: gatewayName("wildcard")},
+		{name: "deep.www.example.com", want: gatewayName("wildcard")},
+		{name: "bucket.s3.example.com", want: gatewayName("s3")},
+		{name: "s3.example.com", want: gatewayName("wildcard")},
+		{name: "example.com", want: "example.com."},
+		{name: "notexample.com", want: "notexample.com."},
+		{name: "example.org", want: "example.org."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asked, reply := serve(t, services, tt.name, dns.TypeA)
+			if asked != tt.want {
+				t.Errorf("ServeDNS(%s) asked the next plugin for %s, want %s", tt.name, asked, tt.want)
+			}
+			if got := reply.Question[0].Name; got != dns.Fqdn(tt.name) {
+				t.Errorf("ServeDNS(%s) question = %s, want it restored", tt.name, got)
+			}
+			if len(reply.Answer) != 1 || reply.Answer[0].Header().Name != dns.Fqdn(tt.name) {
+				t.Errorf("ServeDNS(%s) answer = %v, want it renamed to the queried name", tt.name, reply.Answer)
+			}
+		})
+	}
+}
+
+func TestServeDNS_ipFamilies(t *testing.T) {
+	tests := []struct {
+		name     string
+		families string
+		qtype    uint16
+		nodata   bool
+	}{
+		{name: "unannotated A", qtype: dns.TypeA},
+		{name: "unannotated AAAA", qtype: dns.TypeAAAA},
+		{name: "v4 only A", families: "IPv4", qtype: dns.TypeA},
+		{name: "v4 only AAAA", families: "IPv4", qtype: dns.TypeAAAA, nodata: true},
+		{name: "v6 only A", families: "IPv6", qtype: dns.TypeA, nodata: true},
+		{name: "v6 only AAAA", families: "IPv6", qtype: dns.TypeAAAA},
+		{name: "dual stack A", families: "IPv4,IPv6", qtype: dns.TypeA},
+		{name: "dual stack AAAA", families: "IPv4,IPv6", qtype: dns.TypeAAAA},
+	}
+	for _, tt := range tests {
+		annotations := map[string]string{"egress.monzo.com/dns-names": "api.example.com,*.s3.example.com"}
+		if tt.families != "" {
+			annotations["egress.monzo.com/ip-families"] = tt.families
+		}
+		services := []*api.Service{gatewayService("gateway", 1, annotations)}
+
+		for _, name := range []string{"api.example.com", "bucket.s3.example.com"} {
+			t.Run(tt.name+" "+name, func(t *testing.T) {
+				asked, reply := serve(t, services, name, tt.qtype)
+				if reply.Rcode != dns.RcodeSuccess {
+					t.Errorf("ServeDNS() rcode = %s, want NOERROR", dns.RcodeToString[reply.Rcode])
+				}
+				if got := reply.Question[0].Name; got != dns.Fqdn(name) {
+					t.Errorf("ServeDNS() question = %s, want %s", got, dns.Fqdn(name))
+				}
+
+				if tt.nodata {
+					if asked != "" {
+						t.Errorf("ServeDNS() asked the next plugin for %s, want an answer without it", asked)
+					}
+					if len(reply.Answer) != 0 {
+						t.Errorf("ServeDNS() answer = %v, want no records", reply.Answer)
+					}
+					if !reply.Authoritative {
+						t.Errorf("ServeDNS() reply isn't authoritative")
+					}
+					return
+				}
+
+				if asked != gatewayName("gateway") {
+					t.Errorf("ServeDNS() asked the next plugin for %s, want %s", asked, gatewayName("gateway"))
+				}
+				if len(reply.Answer) != 1 || reply.Answer[0].Header().Rrtype != tt.qtype {
+					t.Errorf("ServeDNS() answer = %v, want one %s record", reply.Answer, dns.TypeToString[tt.qtype])
+				}
+			})
+		}
+	}
+}
+
+func TestServeDNS_aliases(t *testing.T) {
+	services := []*api.Service{
+		gatewayService("conflicted", 2, map[string]string{"egress.monzo.com/dns-names": "www.example.com,example.org"}),
+		gatewayService("example", 1, map[string]string{"egress.monzo.com/dns-names": "example.com,www.example.com"}),
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "example.com", want: gatewayName("example")},
+		{name: "www.example.com", want: gatewayName("example")},
+		{name: "example.org", want: gatewayName("conflicted")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if asked, _ := serve(t, services, tt.name, dns.TypeA); asked != tt.want {
+				t.Errorf("ServeDNS(%s) asked the next plugin for %s, want %s", tt.name, asked, tt.want)
+			}
+		})
+	}
+}
@@ -2,19 +2,61 @@ package egressoperator
 
 import (
 	"context"
+	"regexp"
+	"strings"
 
 	"github.com/coredns/coredns/plugin/rewrite"
 	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
 )
 
+// responseRuleForName is implemented by rules whose response rewrite depends on the name
+// that was queried, rather than being fixed when the rule is created.
+type responseRuleForName interface {
+	responseRule(queried string) rewrite.ResponseRule
+}
+
+// addressFamilyRule is implemented by rules which know which address records their gateway can answer.
+type addressFamilyRule interface {
+	servesType(qtype uint16) bool
+}
+
+// ipFamilies are the families of a gateway Service, from its ip-families annotation, such as IPv4 or IPv6
+type ipFamilies []string
+
+// servesType returns false for A or AAAA queries the gateway has no address for. Services without an
+// ip-families annotation are assumed to serve everything, leaving the answer to the kubernetes plugin.
+func (f ipFamilies) servesType(qtype uint16) bool {
+	if len(f) == 0 {
+		return true
+	}
+	var want string
+	switch qtype {
+	case dns.TypeA:
+		want = "IPv4"
+	case dns.TypeAAAA:
+		want = "IPv6"
+	default:
+		return true
+	}
+	for _, family := range f {
+		if family == want {
+			return true
+		}
+	}
+	return false
+}
+
 type exactNameRule struct {
 	NextAction string
 	From       string
 	To         string
 	rewrite.ResponseRule
+	ipFamilies
 }
 
 var _ rewrite.Rule = &exactNameRule{}
+var _ addressFamilyRule = &exactNameRule{}
 
 // Rewrite rewrites the current request based upon exact match of the name
 // in the question section of the request.
@@ -31,3 +73,44 @@ func (rule *exactNameRule) Mode() string { return rule.NextAction }
 
 // GetResponseRule return a rule to rewrite the response with. Currently not implemented.
 func (rule *exactNameRule) GetResponseRule() rewrite.ResponseRule { return rule.ResponseRule }
+
+// suffixNameRule rewrites any name below Suffix, such as those matched by a
+// wildcard like *.s3.eu-west-1.amazonaws.com
+type suffixNameRule struct {
+	NextAction string
+	// Suffix is the normalized name the wildcard applies to, with a leading dot
+	Suffix string
+	To     string
+	ipFamilies
+}
+
+var _ rewrite.Rule = &suffixNameRule{}
+var _ responseRuleForName = &suffixNameRule{}
+var _ addressFamilyRule = &suffixNameRule{}
+
+// Rewrite rewrites the current request if the name in the question section is
+// a subdomain of the rule's suffix.
+func (rule *suffixNameRule) Rewrite(ctx context.Context, state request.Request) rewrite.Result {
+	name := state.Name()
+	if len(name) > len(rule.Suffix) && strings.HasSuffix(name, rule.Suffix) {
+		state.Req.Question[0].Name = rule.To
+		return rewrite.RewriteDone
+	}
+	return rewrite.RewriteIgnored
+}
+
+// Mode returns the processing nextAction
+func (rule *suffixNameRule) Mode() string { return rule.NextAction }
+
+// GetResponseRule is unused, as answers must be rewritten to the name each
+// query asked for; see responseRule.
+func (rule *suffixNameRule) GetResponseRule() rewrite.ResponseRule { return rewrite.ResponseRule{} }
+
+func (rule *suffixNameRule) responseRule(queried string) rewrite.ResponseRule {
+	return rewrite.ResponseRule{
+		Active:      true,
+		Type:        "name",
+		Pattern:     regexp.MustCompile("^" + regexp.QuoteMeta(rule.To) + "$"),
+		Replacement: queried,
+	}
+}
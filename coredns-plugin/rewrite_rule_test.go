@@ -0,0 +1,33 @@
+package egressoperator
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func Test_ipFamilies_servesType(t *testing.T) {
+	tests := []struct {
+		name     string
+		families ipFamilies
+		qtype    uint16
+		want     bool
+	}{
+		{name: "unannotated A", families: nil, qtype: dns.TypeA, want: true},
+		{name: "unannotated AAAA", families: nil, qtype: dns.TypeAAAA, want: true},
+		{name: "v4 only A", families: ipFamilies{"IPv4"}, qtype: dns.TypeA, want: true},
+		{name: "v4 only AAAA", families: ipFamilies{"IPv4"}, qtype: dns.TypeAAAA, want: false},
+		{name: "v6 only A", families: ipFamilies{"IPv6"}, qtype: dns.TypeA, want: false},
+		{name: "v6 only AAAA", families: ipFamilies{"IPv6"}, qtype: dns.TypeAAAA, want: true},
+		{name: "dual stack A", families: ipFamilies{"IPv4", "IPv6"}, qtype: dns.TypeA, want: true},
+		{name: "dual stack AAAA", families: ipFamilies{"IPv4", "IPv6"}, qtype: dns.TypeAAAA, want: true},
+		{name: "v4 only other type", families: ipFamilies{"IPv4"}, qtype: dns.TypeTXT, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.families.servesType(tt.qtype); got != tt.want {
+				t.Errorf("servesType(%s) = %v, want %v", dns.TypeToString[tt.qtype], got, tt.want)
+			}
+		})
+	}
+}
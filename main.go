@@ -19,6 +19,7 @@ import (
 	"flag"
 	"os"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"time"
@@ -54,29 +55,54 @@ func init() {
 func main() {
 	var (
 		metricsAddr                string
+		probeAddr                  string
 		enableLeaderElection       bool
 		enablePodDisruptionBudgets bool
+		overflowCheckInterval      time.Duration
+		xdsBindAddress             string
+		xdsAddress                 string
+		validateConfigWithEnvoy    bool
 	)
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&probeAddr, "health-probe-addr", ":8081", "The address the liveness and readiness probes bind to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	flag.BoolVar(&enablePodDisruptionBudgets, "enable-pod-disruption-budgets", false,
 		"Enable deploying pod disruption budgets for egress gateways.")
+	flag.DurationVar(&overflowCheckInterval, "overflow-check-interval", 0,
+		"How often to check gateway stats for circuit breaker overflows, reported as the CircuitBreakerOverflow condition. Disabled if 0.")
+	flag.StringVar(&xdsBindAddress, "xds-bind-address", ":18000", "The address the xDS server binds to.")
+	flag.StringVar(&xdsAddress, "xds-address", "",
+		"The host:port gateways reach the xDS server at. If set, gateways get their listeners and clusters over xDS instead of restarting for each change.")
+	flag.BoolVar(&validateConfigWithEnvoy, "validate-config-with-envoy", false,
+		"Run each new gateway configuration through envoy --mode validate in a Job before rolling it out.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(func(o *zap.Options) {
 		o.Development = true
 	}))
 
+	defaultAccessLog, err := controllers.ParseDefaultAccessLog(os.Getenv("DEFAULT_ACCESS_LOG"))
+	if err != nil {
+		setupLog.Error(err, "unable to parse DEFAULT_ACCESS_LOG")
+		os.Exit(1)
+	}
+	defaultPodTemplateOverlay, err := controllers.ParseDefaultPodTemplateOverlay(os.Getenv("DEFAULT_POD_TEMPLATE_OVERLAY"))
+	if err != nil {
+		setupLog.Error(err, "unable to parse DEFAULT_POD_TEMPLATE_OVERLAY")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
 		Metrics: metricsserver.Options{
 			BindAddress: metricsAddr,
 		},
-		LeaderElection:   enableLeaderElection,
-		LeaderElectionID: "egress-operator",
-		LeaseDuration:    &leaseDuration,
-		RenewDeadline:    &renewDeadline,
+		HealthProbeBindAddress: probeAddr,
+		LeaderElection:         enableLeaderElection,
+		LeaderElectionID:       "egress-operator",
+		LeaseDuration:          &leaseDuration,
+		RenewDeadline:          &renewDeadline,
 		Cache: cache.Options{
 			DefaultNamespaces: map[string]cache.Config{namespace: {}},
 		},
@@ -89,15 +115,48 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		setupLog.Error(err, "unable to set up health check")
+		os.Exit(1)
+	}
+
+	var xds *controllers.XdsServer
+	readyCheck := healthz.Ping
+	if xdsAddress != "" {
+		xds = controllers.NewXdsServer(xdsBindAddress, xdsAddress, ctrl.Log.WithName("xds"))
+		if err := mgr.Add(xds); err != nil {
+			setupLog.Error(err, "unable to add xDS server")
+			os.Exit(1)
+		}
+		// Only the leader serves xDS, so the other replicas are kept out of the xds Service
+		readyCheck = xds.Ready
+	}
+	if err := mgr.AddReadyzCheck("readyz", readyCheck); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.ExternalServiceReconciler{
 		Client:                     mgr.GetClient(),
 		Log:                        ctrl.Log.WithName("controllers").WithName("ExternalService"),
 		Scheme:                     mgr.GetScheme(),
+		Recorder:                   mgr.GetEventRecorderFor("egress-operator"),
 		EnablePodDisruptionBudgets: enablePodDisruptionBudgets,
+		OverflowCheckInterval:      overflowCheckInterval,
+		Xds:                        xds,
+		ValidateConfigWithEnvoy:    validateConfigWithEnvoy,
+		DefaultAccessLog:           defaultAccessLog,
+		DefaultPodTemplateOverlay:  defaultPodTemplateOverlay,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ExternalService")
 		os.Exit(1)
 	}
+	if os.Getenv("ENABLE_WEBHOOKS") == "true" {
+		if err = (&egressv1.ExternalService{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ExternalService")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")